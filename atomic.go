@@ -0,0 +1,58 @@
+package honoka
+
+import (
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "runtime"
+)
+
+// writeFileAtomic writes data to path so that readers see either the old
+// content or the new content, never a torn write: the data goes to a temp
+// file in the same directory, which is fsynced and renamed over path, and
+// then the directory itself is fsynced.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+    dir := filepath.Dir(path)
+    f, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp")
+    if err != nil {
+        return err
+    }
+    tmp := f.Name()
+    if err = writeAndSync(f, data, perm); err != nil {
+        os.Remove(tmp)
+        return err
+    }
+    if err = os.Rename(tmp, path); err != nil {
+        os.Remove(tmp)
+        return err
+    }
+    return syncDir(dir)
+}
+
+func writeAndSync(f *os.File, data []byte, perm os.FileMode) error {
+    _, err := f.Write(data)
+    if err == nil {
+        err = f.Chmod(perm)
+    }
+    if err == nil {
+        err = f.Sync()
+    }
+    if e := f.Close(); err == nil {
+        err = e
+    }
+    return err
+}
+
+// syncDir fsyncs a directory so that a rename inside it is durable.
+// Windows cannot sync directories, so it is a no-op there.
+func syncDir(dir string) error {
+    if runtime.GOOS == "windows" {
+        return nil
+    }
+    d, err := os.Open(dir)
+    if err != nil {
+        return err
+    }
+    defer d.Close()
+    return d.Sync()
+}
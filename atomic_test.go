@@ -0,0 +1,37 @@
+package honoka
+
+import (
+    "io/ioutil"
+    "path/filepath"
+    "testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+    dir := t.TempDir()
+    path := filepath.Join(dir, "index")
+
+    for _, expected := range []string{"{\"first\":1}", "{}"} {
+        err := writeFileAtomic(path, []byte(expected), 0600)
+        if err != nil {
+            t.Fatalf("occurred error when write file: %v", err)
+        }
+        actual, err := ioutil.ReadFile(path)
+        if err != nil {
+            t.Fatalf("occurred error when read file: %v", err)
+        }
+        if string(actual) != expected {
+            t.Errorf("actual does not match expected. actual: %s , expected: %s", actual, expected)
+        }
+    }
+
+    files, err := ioutil.ReadDir(dir)
+    if err != nil {
+        t.Fatalf("occurred error when read directory: %v", err)
+    }
+    if len(files) != 1 {
+        t.Errorf("temp files are left behind: %d files", len(files))
+    }
+    if perm := files[0].Mode().Perm(); perm != 0600 {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", perm, 0600)
+    }
+}
@@ -0,0 +1,345 @@
+package honoka
+
+import (
+    "context"
+    "fmt"
+    "reflect"
+    "sort"
+    "strings"
+)
+
+// MultiError is returned by the batch methods when some keys failed. It
+// maps each failed key to its error. Keys that are missing or expired map
+// to CacheIsExpired, as Get reports them.
+//
+// Example:
+//   values, err := cli.GetMulti([]string{"foo", "bar"})
+//   if errs, ok := err.(honoka.MultiError); ok {
+//       fmt.Println(errs["bar"])
+//   }
+type MultiError map[string]error
+
+func (e MultiError) Error() string {
+    keys := make([]string, 0, len(e))
+    for key := range e {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    msgs := make([]string, len(keys))
+    for i, key := range keys {
+        msgs[i] = fmt.Sprintf("%s: %v", key, e[key])
+    }
+    return fmt.Sprintf("honoka: %d keys failed: %s", len(keys), strings.Join(msgs, "; "))
+}
+
+// errOrNil returns e as an error, or nil if no key failed.
+func (e MultiError) errOrNil() error {
+    if len(e) == 0 {
+        return nil
+    }
+    return e
+}
+
+// GetMulti is GetJson for several keys. It returns the caches that were
+// found, and a MultiError for the rest. Expired entries are removed in a
+// single index update.
+//
+// Example:
+//   cli, err := honoka.New()
+//   values, err := cli.GetMulti([]string{"foo", "bar"})
+func (c *Client) GetMulti(keys []string) (map[string][]byte, error) {
+    return c.GetMultiContext(context.Background(), keys)
+}
+
+// GetMultiContext is GetMulti that gives up when ctx is done.
+func (c *Client) GetMultiContext(ctx context.Context, keys []string) (map[string][]byte, error) {
+    found, errs := c.fetchMulti(ctx, keys)
+    values := make(map[string][]byte, len(found))
+    for key, v := range found {
+        b, err := v.json()
+        if err != nil {
+            errs[key] = err
+            continue
+        }
+        values[key] = b
+    }
+    return values, errs.errOrNil()
+}
+
+// GetMulti is the typed form of Client.GetMulti.
+//
+// Example:
+//   repos, err := honoka.GetMulti[Repository](cli, []string{"github:repo:foo", "github:repo:bar"})
+func GetMulti[T any](c *Client, keys []string) (map[string]T, error) {
+    found, errs := c.fetchMulti(context.Background(), keys)
+    values := make(map[string]T, len(found))
+    typ := reflect.TypeOf((*T)(nil)).Elem()
+    for key, cache := range found {
+        if d, hit := c.memory.getDecodedVersion(key, cache.version, typ); hit {
+            values[key], _ = d.(T)
+            continue
+        }
+        var v T
+        if err := decodeCached(key, cache, &v); err != nil {
+            errs[key] = err
+            continue
+        }
+        c.memory.putDecoded(key, cache.version, typ, v)
+        values[key] = v
+    }
+    return values, errs.errOrNil()
+}
+
+// fetchMulti is fetch for several keys.
+func (c *Client) fetchMulti(ctx context.Context, keys []string) (map[string]cached, MultiError) {
+    values := make(map[string]cached, len(keys))
+    errs := MultiError{}
+    drop := make(map[string]func(Index) bool)
+    for _, key := range keys {
+        idx, exists := c.lookup(key)
+        if !exists || c.expired(idx) {
+            if exists && c.removable(idx) {
+                drop[key] = c.removable
+            }
+            errs[key] = CacheIsExpired
+            continue
+        }
+        if v, hit := c.memory.get(key, idx.Bucket); hit {
+            values[key] = v
+            c.touch(key)
+            continue
+        }
+        if err := ctx.Err(); err != nil {
+            errs[key] = err
+            continue
+        }
+        idx, v, err := c.loadCurrent(key, idx)
+        if err == ErrCorrupted && c.corruptionAsMiss {
+            bucket := idx.Bucket
+            drop[key] = func(i Index) bool { return i.Bucket == bucket }
+            err = CacheIsExpired
+        }
+        if err != nil {
+            errs[key] = err
+            continue
+        }
+        c.memory.put(key, idx.Bucket, v)
+        c.touch(key)
+        values[key] = v
+    }
+    if len(drop) > 0 {
+        c.deleteIfMulti(ctx, drop)
+    }
+    return values, errs
+}
+
+// SetMulti is SetNX for several keys with the same expiration. The
+// buckets are written first and the index is updated once. Keys that
+// still hold a valid cache are left alone. It reports for each key whether
+// it was written; keys that failed are reported as not written and listed
+// in a MultiError.
+//
+// Example:
+//   cli, err := honoka.New()
+//   written, err := cli.SetMulti(map[string]interface{}{"foo": 1, "bar": 2}, 100)
+func (c *Client) SetMulti(items map[string]interface{}, expire int64, opts ...CallOption) (map[string]bool, error) {
+    return c.SetMultiContext(context.Background(), items, expire, opts...)
+}
+
+// SetMultiContext is SetMulti that gives up waiting for the index lock
+// when ctx is done.
+func (c *Client) SetMultiContext(ctx context.Context, items map[string]interface{}, expire int64, opts ...CallOption) (map[string]bool, error) {
+    result := make(map[string]bool, len(items))
+    if len(items) == 0 {
+        return result, nil
+    }
+    o := newCallOptions(opts)
+    unlock, err := c.lockIndexContext(ctx)
+    if err != nil {
+        return nil, err
+    }
+    defer unlock()
+
+    idx, err := c.loadIndexer()
+    if err != nil {
+        return nil, err
+    }
+    keys := make([]string, 0, len(items))
+    for key := range items {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+
+    errs := MultiError{}
+    exp := c.createExpiration(expire)
+    codec := c.codecFor(o)
+    written := make(map[string]cached)
+    replaced := make(map[string]Index)
+    var writtenKeys []string
+    for _, key := range keys {
+        result[key] = false
+        current, exists := idx[key]
+        if exists && !c.expired(current) {
+            continue
+        }
+        entry := c.newIndex(key, c.newBucketName(key, exp, current), exp)
+        version, err := c.nextVersion(current)
+        if err != nil {
+            return nil, err
+        }
+        entry.Version = version
+        data, err := c.createNewBucket(&entry, items[key], codec)
+        if err != nil {
+            errs[key] = err
+            continue
+        }
+        replaced[key] = current
+        idx[key] = entry
+        written[key] = cached{data: data, codec: codec, version: entry.Version}
+        writtenKeys = append(writtenKeys, key)
+    }
+    if len(written) == 0 {
+        c.replaceIndexer(idx)
+        return result, errs.errOrNil()
+    }
+
+    if err = c.evict(idx, writtenKeys...); err != nil {
+        return nil, err
+    }
+    if err = c.setIndexer(idx); err != nil {
+        return nil, err
+    }
+    for key, v := range written {
+        c.deleteReplaced(replaced[key], idx[key])
+        c.memory.put(key, idx[key].Bucket, v)
+        result[key] = true
+    }
+    return result, errs.errOrNil()
+}
+
+// DeleteMulti is Delete for several keys with a single index update. It
+// returns the keys that existed and were deleted.
+//
+// Example:
+//   cli, err := honoka.New()
+//   deleted, err := cli.DeleteMulti([]string{"foo", "bar"})
+func (c *Client) DeleteMulti(keys []string) ([]string, error) {
+    return c.DeleteMultiContext(context.Background(), keys)
+}
+
+// DeleteMultiContext is DeleteMulti that gives up waiting for the index
+// lock when ctx is done.
+func (c *Client) DeleteMultiContext(ctx context.Context, keys []string) ([]string, error) {
+    conds := make(map[string]func(Index) bool, len(keys))
+    for _, key := range keys {
+        conds[key] = nil
+    }
+    return c.deleteIfMulti(ctx, conds)
+}
+
+// deleteIfMulti is deleteIf for several keys, each with its own condition.
+// It returns the deleted keys, and a MultiError for the keys whose bucket
+// could not be deleted, which are kept in the index.
+func (c *Client) deleteIfMulti(ctx context.Context, conds map[string]func(Index) bool) ([]string, error) {
+    if len(conds) == 0 {
+        return nil, nil
+    }
+    unlock, err := c.lockIndexContext(ctx)
+    if err != nil {
+        return nil, err
+    }
+    defer unlock()
+
+    var idx IndexList
+    if c.entryStore() == nil {
+        if idx, err = c.loadIndexer(); err != nil {
+            return nil, err
+        }
+    }
+    return c.removeEntries(idx, conds)
+}
+
+// removeEntries deletes the entries of idx whose condition holds, with
+// their buckets, and saves idx. It returns the deleted keys.
+// With an EntryStore the entries are deleted with their buckets instead,
+// and idx may be nil. The caller must hold the index lock.
+func (c *Client) removeEntries(idx IndexList, conds map[string]func(Index) bool) ([]string, error) {
+    if es := c.entryStore(); es != nil {
+        return c.removeEntriesOf(es, idx, conds)
+    }
+    errs := MultiError{}
+    var deleted []string
+    for key, cond := range conds {
+        i, exists := idx[key]
+        if !exists {
+            continue
+        }
+        if cond != nil && !cond(i) {
+            continue
+        }
+        if err := c.store.DeleteBucket(i.Bucket); err != nil {
+            errs[key] = err
+            continue
+        }
+        delete(idx, key)
+        deleted = append(deleted, key)
+    }
+    if len(deleted) == 0 {
+        c.replaceIndexer(idx)
+        return nil, errs.errOrNil()
+    }
+
+    sort.Strings(deleted)
+    for _, key := range deleted {
+        c.memory.remove(key)
+    }
+    if err := c.setIndexer(idx); err != nil {
+        return nil, err
+    }
+    return deleted, errs.errOrNil()
+}
+
+// removeEntriesOf is removeEntries for an EntryStore, which deletes the
+// entries in a single call. If idx is nil the entries are read from the
+// store.
+func (c *Client) removeEntriesOf(es EntryStore, idx IndexList, conds map[string]func(Index) bool) ([]string, error) {
+    errs := MultiError{}
+    var deleted []string
+    for key, cond := range conds {
+        i, exists := idx[key]
+        if idx == nil {
+            var err error
+            if i, exists, err = es.LoadEntry(key); err != nil {
+                errs[key] = err
+                continue
+            }
+        }
+        if !exists {
+            continue
+        }
+        if cond != nil && !cond(i) {
+            continue
+        }
+        deleted = append(deleted, key)
+    }
+    if len(deleted) == 0 {
+        return nil, errs.errOrNil()
+    }
+
+    sort.Strings(deleted)
+    if err := es.DeleteEntries(deleted); err != nil {
+        for _, key := range deleted {
+            errs[key] = err
+        }
+        return nil, errs
+    }
+    c.mu.Lock()
+    for _, key := range deleted {
+        delete(c.Indexer, key)
+    }
+    c.mu.Unlock()
+    for _, key := range deleted {
+        c.memory.remove(key)
+    }
+    return deleted, errs.errOrNil()
+}
@@ -0,0 +1,125 @@
+package honoka
+
+import (
+    "bytes"
+    "io/ioutil"
+    "os"
+    "testing"
+    "time"
+)
+
+// countingStore counts index writes.
+type countingStore struct {
+    *MemoryStore
+    saves int
+}
+
+func (s *countingStore) SaveIndex(idx IndexList) error {
+    s.saves++
+    return s.MemoryStore.SaveIndex(idx)
+}
+
+func TestBatch(t *testing.T) {
+    store := &countingStore{MemoryStore: NewMemoryStore()}
+    cli := newTestClient(t, WithStore(store))
+
+    items := map[string]interface{}{"foo": "1", "bar": "2", "fizz": "3"}
+    written, err := cli.SetMulti(items, 100)
+    if err != nil {
+        t.Fatalf("occurred error when set caches: %v", err)
+    }
+    if len(written) != 3 || !written["foo"] || !written["bar"] || !written["fizz"] {
+        t.Errorf("actual does not match expected. actual: %v , expected: %s", written, "all written")
+    }
+    if store.saves != 1 {
+        t.Errorf("actual does not match expected. actual: %d index writes , expected: %d", store.saves, 1)
+    }
+
+    values, err := GetMulti[string](cli, []string{"foo", "bar", "missing"})
+    errs, ok := err.(MultiError)
+    if !ok || len(errs) != 1 || errs["missing"] != CacheIsExpired {
+        t.Errorf("actual does not match expected. actual: %v , expected: %s", err, "missing is expired")
+    }
+    if len(values) != 2 || values["foo"] != "1" || values["bar"] != "2" {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", values, "foo and bar")
+    }
+
+    store.saves = 0
+    deleted, err := cli.DeleteMulti([]string{"foo", "fizz", "missing"})
+    if err != nil {
+        t.Fatalf("occurred error when delete caches: %v", err)
+    }
+    if len(deleted) != 2 || deleted[0] != "fizz" || deleted[1] != "foo" {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", deleted, []string{"fizz", "foo"})
+    }
+    if store.saves != 1 {
+        t.Errorf("actual does not match expected. actual: %d index writes , expected: %d", store.saves, 1)
+    }
+    list, err := cli.List()
+    if err != nil || len(list) != 1 || list[0].Key != "bar" {
+        t.Errorf("actual does not match expected. actual: %v (%v) , expected: %s", list, err, "bar only")
+    }
+}
+
+// countRecords returns the number of records in the journal of store.
+func countRecords(t *testing.T, store *FileStore) int {
+    journal, err := ioutil.ReadFile(store.getJournalPath())
+    if err != nil && !os.IsNotExist(err) {
+        t.Fatalf("occurred error when read journal: %v", err)
+    }
+    return bytes.Count(journal, []byte("\n"))
+}
+
+func TestDeleteMultiFileStore(t *testing.T) {
+    store := NewFileStore(t.TempDir())
+    cli := newTestClient(t, WithStore(store))
+    items := map[string]interface{}{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5}
+    if _, err := cli.SetMulti(items, 100); err != nil {
+        t.Fatalf("occurred error when set caches: %v", err)
+    }
+
+    records := countRecords(t, store)
+    deleted, err := cli.DeleteMulti([]string{"a", "b", "c", "d", "e"})
+    if err != nil || len(deleted) != 5 {
+        t.Fatalf("actual does not match expected. actual: %v (%v) , expected: %d keys", deleted, err, 5)
+    }
+    if n := countRecords(t, store) - records; n != 1 {
+        t.Errorf("actual does not match expected. actual: %d records , expected: %d records", n, 1)
+    }
+    if buckets, _ := store.ListBuckets(); len(buckets) != 0 {
+        t.Errorf("buckets are left behind: %v", buckets)
+    }
+}
+
+func TestSetMultiKeepsValidCaches(t *testing.T) {
+    cli := newTestClient(t)
+    cli.Set("foo", "old", 100)
+    written, err := cli.SetMulti(map[string]interface{}{"foo": "new", "bar": "new"}, 100)
+    if err != nil {
+        t.Fatalf("occurred error when set caches: %v", err)
+    }
+    if written["foo"] || !written["bar"] {
+        t.Errorf("actual does not match expected. actual: %v , expected: %s", written, "only bar written")
+    }
+    values, err := cli.GetMulti([]string{"foo", "bar"})
+    if err != nil || string(values["foo"]) != `"old"` || string(values["bar"]) != `"new"` {
+        t.Errorf("actual does not match expected. actual: %s (%v) , expected: %s", values, err, "old foo and new bar")
+    }
+}
+
+func TestSetMultiDeletesReplacedBuckets(t *testing.T) {
+    now := time.Unix(1000, 0)
+    clock := func() time.Time { return now }
+    cli := newTestClient(t, WithClock(clock), WithStaleWhileRevalidate(60))
+    cli.Set("foo", "old", 10)
+
+    // An entry in its grace window is replaced, not removed, by SetMulti.
+    now = now.Add(30 * time.Second)
+    if _, err := cli.SetMulti(map[string]interface{}{"foo": "new"}, 100); err != nil {
+        t.Fatalf("occurred error when set caches: %v", err)
+    }
+    outdated, err := cli.Outdated()
+    if err != nil || len(outdated) != 0 {
+        t.Errorf("replaced buckets are left behind: %v (%v)", outdated, err)
+    }
+}
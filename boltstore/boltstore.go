@@ -0,0 +1,411 @@
+// Package boltstore is a honoka.Store that keeps the index and all buckets
+// in a single bbolt database file instead of one file per bucket.
+//
+// Example:
+//   cli, err := honoka.New(boltstore.With("~/.honoka/cache.db", 0644, 10 * time.Second))
+//   defer cli.Close()
+package boltstore
+
+import (
+    "context"
+    "encoding/binary"
+    "encoding/json"
+    "os"
+    "sort"
+    "sync"
+    "time"
+
+    homedir "github.com/mitchellh/go-homedir"
+    "github.com/YusukeKomatsu/honoka"
+    bolt "go.etcd.io/bbolt"
+)
+
+var (
+    indexBucket   = []byte("index")
+    bucketsBucket = []byte("buckets")
+    metaBucket    = []byte("meta")
+
+    // Holds one nested bucket per namespace, each with its own index,
+    // buckets and meta.
+    namespacesBucket = []byte("namespaces")
+
+    // Present in metaBucket once an index has been saved.
+    savedKey      = []byte("index-saved")
+
+    // Highest version any index entry has had, kept in metaBucket.
+    maxVersionKey = []byte("max-version")
+)
+
+// Store is a honoka.Store backed by a bbolt database. Every call runs in
+// its own transaction, and index updates write only the changed entries.
+// It is also a honoka.EntryStore: a single Set or Update writes its bucket
+// and index entry in one transaction, and Delete removes them in one, all
+// without reading the whole index. SetMulti and the writes of a Client
+// with size limits still save the whole index, in a transaction separate
+// from their buckets.
+//
+// bbolt holds an exclusive lock on the file while it is open, so only one
+// process at a time can use the database; others wait up to the open
+// timeout.
+type Store struct {
+    db   *bolt.DB
+    lock chan struct{}
+
+    // Name of the namespace, or nil for the default one.
+    ns   []byte
+
+    // mu guards namespaces, the Stores handed out by Namespace, so that
+    // every user of a namespace shares its lock.
+    mu         sync.Mutex
+    namespaces map[string]*Store
+}
+
+// Open opens or creates the database at path.
+func Open(path string, mode os.FileMode, timeout time.Duration) (*Store, error) {
+    path, err := homedir.Expand(path)
+    if err != nil {
+        return nil, err
+    }
+    db, err := bolt.Open(path, mode, &bolt.Options{Timeout: timeout})
+    if err != nil {
+        if err == bolt.ErrTimeout {
+            return nil, honoka.ErrLockTimeout
+        }
+        return nil, err
+    }
+    err = db.Update(func(tx *bolt.Tx) error {
+        for _, name := range [][]byte{indexBucket, bucketsBucket, metaBucket, namespacesBucket} {
+            if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        db.Close()
+        return nil, err
+    }
+    return &Store{
+        db:   db,
+        lock: make(chan struct{}, 1),
+    }, nil
+}
+
+// With returns a honoka.Option that makes the Client use the database at
+// path, created with mode and waiting up to timeout for another process to
+// release it, as with Open. honoka.WithFileMode and honoka.WithLockTimeout
+// do not apply to the database. Client.Close closes the database.
+func With(path string, mode os.FileMode, timeout time.Duration) honoka.Option {
+    return func(c *honoka.Client) error {
+        store, err := Open(path, mode, timeout)
+        if err != nil {
+            return err
+        }
+        return honoka.WithStore(store)(c)
+    }
+}
+
+// Namespace returns the Store for the named namespace in the same database.
+// Every call for a name returns the same Store. Closing any of them closes
+// the database.
+func (s *Store) Namespace(name string) (honoka.Store, error) {
+    if s.ns != nil {
+        return nil, honoka.ErrNamespaceUnsupported
+    }
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if ns, exists := s.namespaces[name]; exists {
+        return ns, nil
+    }
+    ns := []byte(name)
+    err := s.db.Update(func(tx *bolt.Tx) error {
+        b, err := tx.Bucket(namespacesBucket).CreateBucketIfNotExists(ns)
+        if err != nil {
+            return err
+        }
+        for _, name := range [][]byte{indexBucket, bucketsBucket, metaBucket} {
+            if _, err = b.CreateBucketIfNotExists(name); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    store := &Store{
+        db:   s.db,
+        lock: make(chan struct{}, 1),
+        ns:   ns,
+    }
+    if s.namespaces == nil {
+        s.namespaces = make(map[string]*Store)
+    }
+    s.namespaces[name] = store
+    return store, nil
+}
+
+func (s *Store) Namespaces() ([]string, error) {
+    var list []string
+    err := s.db.View(func(tx *bolt.Tx) error {
+        return tx.Bucket(namespacesBucket).ForEach(func(k, v []byte) error {
+            list = append(list, string(k))
+            return nil
+        })
+    })
+    return list, err
+}
+
+// bucket returns the named bolt bucket of the Store's namespace.
+func (s *Store) bucket(tx *bolt.Tx, name []byte) *bolt.Bucket {
+    if s.ns == nil {
+        return tx.Bucket(name)
+    }
+    return tx.Bucket(namespacesBucket).Bucket(s.ns).Bucket(name)
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+    return s.db.Close()
+}
+
+func (s *Store) ReadBucket(name string) ([]byte, error) {
+    var data []byte
+    err := s.db.View(func(tx *bolt.Tx) error {
+        v := s.bucket(tx, bucketsBucket).Get([]byte(name))
+        if v == nil {
+            return honoka.BucketFileNotFound
+        }
+        data = append([]byte(nil), v...)
+        return nil
+    })
+    return data, err
+}
+
+func (s *Store) WriteBucket(name string, data []byte) error {
+    return s.db.Update(func(tx *bolt.Tx) error {
+        return s.bucket(tx, bucketsBucket).Put([]byte(name), data)
+    })
+}
+
+func (s *Store) DeleteBucket(name string) error {
+    return s.db.Update(func(tx *bolt.Tx) error {
+        return s.bucket(tx, bucketsBucket).Delete([]byte(name))
+    })
+}
+
+func (s *Store) ListBuckets() ([]string, error) {
+    var list []string
+    err := s.db.View(func(tx *bolt.Tx) error {
+        return s.bucket(tx, bucketsBucket).ForEach(func(k, v []byte) error {
+            list = append(list, string(k))
+            return nil
+        })
+    })
+    return list, err
+}
+
+// LoadIndex returns honoka.IndexFileNotFound until an index is saved.
+func (s *Store) LoadIndex() (honoka.IndexList, error) {
+    idx := honoka.IndexList{}
+    saved := false
+    err := s.db.View(func(tx *bolt.Tx) error {
+        saved = s.bucket(tx, metaBucket).Get(savedKey) != nil
+        return s.bucket(tx, indexBucket).ForEach(func(k, v []byte) error {
+            var entry honoka.Index
+            if err := json.Unmarshal(v, &entry); err != nil {
+                return err
+            }
+            idx[string(k)] = entry
+            return nil
+        })
+    })
+    if err != nil {
+        return nil, err
+    }
+    if !saved {
+        return nil, honoka.IndexFileNotFound
+    }
+    return idx, nil
+}
+
+// SaveIndex stores idx, writing only the entries that changed.
+func (s *Store) SaveIndex(idx honoka.IndexList) error {
+    return s.db.Update(func(tx *bolt.Tx) error {
+        if err := s.bucket(tx, metaBucket).Put(savedKey, []byte{1}); err != nil {
+            return err
+        }
+        b := s.bucket(tx, indexBucket)
+        var stale [][]byte
+        var version uint64
+        err := b.ForEach(func(k, v []byte) error {
+            if _, exists := idx[string(k)]; !exists {
+                var entry honoka.Index
+                if err := json.Unmarshal(v, &entry); err != nil {
+                    return err
+                }
+                if entry.Version > version {
+                    version = entry.Version
+                }
+                stale = append(stale, append([]byte(nil), k...))
+            }
+            return nil
+        })
+        if err != nil {
+            return err
+        }
+        for _, k := range stale {
+            if err = b.Delete(k); err != nil {
+                return err
+            }
+        }
+        keys := make([]string, 0, len(idx))
+        for key := range idx {
+            keys = append(keys, key)
+        }
+        sort.Strings(keys)
+        for _, key := range keys {
+            if idx[key].Version > version {
+                version = idx[key].Version
+            }
+            v, err := json.Marshal(idx[key])
+            if err != nil {
+                return err
+            }
+            if old := b.Get([]byte(key)); old != nil && string(old) == string(v) {
+                continue
+            }
+            if err = b.Put([]byte(key), v); err != nil {
+                return err
+            }
+        }
+        return s.raiseMaxVersion(tx, version)
+    })
+}
+
+// LoadEntry reads the index entry of key alone.
+func (s *Store) LoadEntry(key string) (honoka.Index, bool, error) {
+    var entry honoka.Index
+    exists := false
+    err := s.db.View(func(tx *bolt.Tx) error {
+        v := s.bucket(tx, indexBucket).Get([]byte(key))
+        if v == nil {
+            return nil
+        }
+        exists = true
+        return json.Unmarshal(v, &entry)
+    })
+    return entry, exists, err
+}
+
+// PutEntry writes the bucket of entry and its index entry in one
+// transaction, so a crash cannot leave one without the other.
+func (s *Store) PutEntry(entry honoka.Index, data []byte) error {
+    v, err := json.Marshal(entry)
+    if err != nil {
+        return err
+    }
+    return s.db.Update(func(tx *bolt.Tx) error {
+        if err := s.bucket(tx, bucketsBucket).Put([]byte(entry.Bucket), data); err != nil {
+            return err
+        }
+        if err := s.bucket(tx, indexBucket).Put([]byte(entry.Key), v); err != nil {
+            return err
+        }
+        if err := s.raiseMaxVersion(tx, entry.Version); err != nil {
+            return err
+        }
+        return s.bucket(tx, metaBucket).Put(savedKey, []byte{1})
+    })
+}
+
+// DeleteEntry is DeleteEntries for a single key.
+func (s *Store) DeleteEntry(key string) error {
+    return s.DeleteEntries([]string{key})
+}
+
+// DeleteEntries deletes the index entries of keys and their buckets in one
+// transaction.
+func (s *Store) DeleteEntries(keys []string) error {
+    return s.db.Update(func(tx *bolt.Tx) error {
+        idx := s.bucket(tx, indexBucket)
+        for _, key := range keys {
+            v := idx.Get([]byte(key))
+            if v == nil {
+                continue
+            }
+            var entry honoka.Index
+            if err := json.Unmarshal(v, &entry); err != nil {
+                return err
+            }
+            if err := s.bucket(tx, bucketsBucket).Delete([]byte(entry.Bucket)); err != nil {
+                return err
+            }
+            if err := s.raiseMaxVersion(tx, entry.Version); err != nil {
+                return err
+            }
+            if err := idx.Delete([]byte(key)); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+}
+
+// MaxVersion returns the highest version any index entry has had,
+// including entries deleted since.
+func (s *Store) MaxVersion() (uint64, error) {
+    var version uint64
+    err := s.db.View(func(tx *bolt.Tx) error {
+        if v := s.bucket(tx, metaBucket).Get(maxVersionKey); v != nil {
+            version = binary.BigEndian.Uint64(v)
+        }
+        return nil
+    })
+    return version, err
+}
+
+// raiseMaxVersion records version in the meta bucket if it is higher
+// than the one recorded.
+func (s *Store) raiseMaxVersion(tx *bolt.Tx, version uint64) error {
+    meta := s.bucket(tx, metaBucket)
+    if v := meta.Get(maxVersionKey); v != nil && binary.BigEndian.Uint64(v) >= version {
+        return nil
+    }
+    b := make([]byte, 8)
+    binary.BigEndian.PutUint64(b, version)
+    return meta.Put(maxVersionKey, b)
+}
+
+// Lock serializes index updates within this process. Other processes are
+// already kept out by the lock bbolt holds on the file.
+func (s *Store) Lock(timeout time.Duration) (func(), error) {
+    return s.LockContext(context.Background(), timeout)
+}
+
+// LockContext is Lock that gives up when ctx is done.
+func (s *Store) LockContext(ctx context.Context, timeout time.Duration) (func(), error) {
+    timer := time.NewTimer(timeout)
+    defer timer.Stop()
+    select {
+    case s.lock <- struct{}{}:
+        return func() { <-s.lock }, nil
+    default:
+    }
+    select {
+    case s.lock <- struct{}{}:
+        return func() { <-s.lock }, nil
+    case <-timer.C:
+        return nil, honoka.ErrLockTimeout
+    case <-ctx.Done():
+        return nil, ctx.Err()
+    }
+}
+
+var (
+    _ honoka.Store         = (*Store)(nil)
+    _ honoka.Namespacer    = (*Store)(nil)
+    _ honoka.ContextLocker = (*Store)(nil)
+    _ honoka.EntryStore    = (*Store)(nil)
+    _ honoka.VersionStore  = (*Store)(nil)
+)
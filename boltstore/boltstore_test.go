@@ -0,0 +1,267 @@
+package boltstore
+
+import (
+    "path/filepath"
+    "strconv"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/YusukeKomatsu/honoka"
+)
+
+func TestStore(t *testing.T) {
+    store, err := Open(filepath.Join(t.TempDir(), "cache.db"), 0600, time.Second)
+    if err != nil {
+        t.Fatalf("occurred error when open database: %v", err)
+    }
+    defer store.Close()
+
+    if _, err = store.LoadIndex(); err != honoka.IndexFileNotFound {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, honoka.IndexFileNotFound)
+    }
+    if _, err = store.ReadBucket("foobar"); err != honoka.BucketFileNotFound {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, honoka.BucketFileNotFound)
+    }
+    if err = store.WriteBucket("foobar", []byte("fizzbizz")); err != nil {
+        t.Fatalf("occurred error when write bucket: %v", err)
+    }
+    b, err := store.ReadBucket("foobar")
+    if err != nil || string(b) != "fizzbizz" {
+        t.Errorf("actual does not match expected. actual: %s (%v) , expected: %s", b, err, "fizzbizz")
+    }
+
+    idx := honoka.IndexList{
+        "foo":  {Key: "foo", Bucket: "foobar", Expiration: 100},
+        "fizz": {Key: "fizz", Bucket: "bizz", Expiration: 100},
+    }
+    if err = store.SaveIndex(idx); err != nil {
+        t.Fatalf("occurred error when save index: %v", err)
+    }
+    delete(idx, "fizz")
+    if err = store.SaveIndex(idx); err != nil {
+        t.Fatalf("occurred error when save index: %v", err)
+    }
+    loaded, err := store.LoadIndex()
+    if err != nil || len(loaded) != 1 || loaded["foo"] != idx["foo"] {
+        t.Errorf("actual does not match expected. actual: %v (%v) , expected: %v", loaded, err, idx)
+    }
+
+    unlock, err := store.Lock(time.Second)
+    if err != nil {
+        t.Fatalf("occurred error when lock index: %v", err)
+    }
+    if _, err = store.Lock(20 * time.Millisecond); err != honoka.ErrLockTimeout {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, honoka.ErrLockTimeout)
+    }
+    unlock()
+}
+
+func TestMigrate(t *testing.T) {
+    dir := t.TempDir()
+    src, err := honoka.New(honoka.WithDir(dir))
+    if err != nil {
+        t.Fatalf("occurred error when get cache client: %v", err)
+    }
+    if err = src.Set("testMigrate", "foobar", 100); err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+
+    path := filepath.Join(dir, "cache.db")
+    store, err := Open(path, 0600, time.Second)
+    if err != nil {
+        t.Fatalf("occurred error when open database: %v", err)
+    }
+    if err = honoka.Migrate(store, honoka.NewFileStore(dir)); err != nil {
+        t.Fatalf("occurred error when migrate cache: %v", err)
+    }
+    store.Close()
+
+    cli, err := honoka.New(With(path, 0600, time.Second))
+    if err != nil {
+        t.Fatalf("occurred error when get cache client: %v", err)
+    }
+    defer cli.Close()
+    actual, err := honoka.Get[string](cli, "testMigrate")
+    if err != nil || actual != "foobar" {
+        t.Errorf("actual does not match expected. actual: %s (%v) , expected: %s", actual, err, "foobar")
+    }
+}
+
+func TestNamespace(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "cache.db")
+    store, err := Open(path, 0600, time.Second)
+    if err != nil {
+        t.Fatalf("occurred error when open database: %v", err)
+    }
+    def, err := honoka.New(honoka.WithStore(store))
+    if err != nil {
+        t.Fatalf("occurred error when get cache client: %v", err)
+    }
+    defer def.Close()
+    ns, err := honoka.New(honoka.WithStore(store), honoka.WithNamespace("github-api"))
+    if err != nil {
+        t.Fatalf("occurred error when get cache client: %v", err)
+    }
+    if err = ns.Set("testNamespace", "foobar", 100); err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+    if _, err = honoka.Get[string](def, "testNamespace"); err == nil {
+        t.Errorf("cache of namespace is visible from default namespace")
+    }
+    actual, err := honoka.Get[string](ns, "testNamespace")
+    if err != nil || actual != "foobar" {
+        t.Errorf("actual does not match expected. actual: %s (%v) , expected: %s", actual, err, "foobar")
+    }
+    list, err := def.Namespaces()
+    if err != nil || len(list) != 2 || list[1].Name != "github-api" || list[1].Entries != 1 {
+        t.Errorf("actual does not match expected. actual: %+v (%v) , expected: %s", list, err, "default and github-api")
+    }
+}
+
+// Clients of the same namespace on one Store have to share its lock, or
+// their index updates overwrite each other.
+func TestNamespaceSharedByClients(t *testing.T) {
+    store, err := Open(filepath.Join(t.TempDir(), "cache.db"), 0600, time.Second)
+    if err != nil {
+        t.Fatalf("occurred error when open database: %v", err)
+    }
+    defer store.Close()
+
+    var wg sync.WaitGroup
+    for g := 0; g < 8; g++ {
+        cli, err := honoka.New(honoka.WithStore(store), honoka.WithNamespace("ns"))
+        if err != nil {
+            t.Fatalf("occurred error when get cache client: %v", err)
+        }
+        wg.Add(1)
+        go func(g int) {
+            defer wg.Done()
+            for i := 0; i < 20; i++ {
+                key := "key" + strconv.Itoa(g) + "." + strconv.Itoa(i)
+                if _, err := cli.SetMulti(map[string]interface{}{key: i}, 100); err != nil {
+                    t.Errorf("occurred error when set cache: %v", err)
+                }
+            }
+        }(g)
+    }
+    wg.Wait()
+
+    ns, err := store.Namespace("ns")
+    if err != nil {
+        t.Fatalf("occurred error when open namespace: %v", err)
+    }
+    idx, err := ns.LoadIndex()
+    if err != nil || len(idx) != 160 {
+        t.Errorf("actual does not match expected. actual: %d (%v) , expected: %d", len(idx), err, 160)
+    }
+}
+
+// A failed New must not keep the database, and its lock, open.
+func TestFailedNewClosesDatabase(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "cache.db")
+    _, err := honoka.New(With(path, 0600, 200 * time.Millisecond), honoka.WithNamespace("bad name"))
+    if err != honoka.ErrInvalidNamespace {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, honoka.ErrInvalidNamespace)
+    }
+    cli, err := honoka.New(With(path, 0600, 200 * time.Millisecond))
+    if err != nil {
+        t.Fatalf("occurred error when get cache client: %v", err)
+    }
+    cli.Close()
+}
+
+// countingStore counts the calls that read or write the whole index.
+type countingStore struct {
+    *Store
+    loads, saves int
+}
+
+func (s *countingStore) LoadIndex() (honoka.IndexList, error) {
+    s.loads++
+    return s.Store.LoadIndex()
+}
+
+func (s *countingStore) SaveIndex(idx honoka.IndexList) error {
+    s.saves++
+    return s.Store.SaveIndex(idx)
+}
+
+func TestWritesEntries(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "cache.db")
+    store, err := Open(path, 0600, time.Second)
+    if err != nil {
+        t.Fatalf("occurred error when open database: %v", err)
+    }
+    counting := &countingStore{Store: store}
+    cli, err := honoka.New(honoka.WithStore(counting))
+    if err != nil {
+        t.Fatalf("occurred error when get cache client: %v", err)
+    }
+    counting.loads = 0
+    if err = cli.Set("foo", "old", 100); err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+    if err = cli.Put("foo", "new", 100); err != nil {
+        t.Fatalf("occurred error when put cache: %v", err)
+    }
+    updater := func() (interface{}, error) { return "bar", nil }
+    if _, err = cli.UpdateJson("bar", updater, 100); err != nil {
+        t.Fatalf("occurred error when update cache: %v", err)
+    }
+    if err = cli.Set("fizz", "bizz", 100); err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+    if err = cli.Delete("fizz"); err != nil {
+        t.Fatalf("occurred error when delete cache: %v", err)
+    }
+    if counting.loads != 0 || counting.saves != 0 {
+        t.Errorf("whole index is used for single writes. loads: %d , saves: %d", counting.loads, counting.saves)
+    }
+    outdated, err := cli.Outdated()
+    if err != nil || len(outdated) != 0 {
+        t.Errorf("replaced buckets are left behind: %v (%v)", outdated, err)
+    }
+    cli.Close()
+
+    reopened, err := honoka.New(With(path, 0600, time.Second))
+    if err != nil {
+        t.Fatalf("occurred error when get cache client: %v", err)
+    }
+    defer reopened.Close()
+    actual, err := honoka.Get[string](reopened, "foo")
+    if err != nil || actual != "new" {
+        t.Errorf("actual does not match expected. actual: %s (%v) , expected: %s", actual, err, "new")
+    }
+    if _, err = honoka.Get[string](reopened, "fizz"); err != honoka.CacheIsExpired {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, honoka.CacheIsExpired)
+    }
+}
+
+func TestVersionAcrossDeletes(t *testing.T) {
+    now := time.Unix(1000, 0)
+    clock := func() time.Time { return now }
+    path := filepath.Join(t.TempDir(), "cache.db")
+    store, err := Open(path, 0600, time.Second)
+    if err != nil {
+        t.Fatalf("occurred error when open database: %v", err)
+    }
+    cli, err := honoka.New(honoka.WithStore(store), honoka.WithClock(clock))
+    if err != nil {
+        t.Fatalf("occurred error when get cache client: %v", err)
+    }
+    defer cli.Close()
+    var first, second uint64
+    if err = cli.Set("testVersion", "foo", 100, honoka.ReturnVersion(&first)); err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+    if err = cli.Delete("testVersion"); err != nil {
+        t.Fatalf("occurred error when delete cache: %v", err)
+    }
+    if err = cli.Set("testVersion", "bar", 100, honoka.ReturnVersion(&second)); err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+    if second <= first {
+        t.Errorf("version does not increase across delete. actual: %d , expected: > %d", second, first)
+    }
+}
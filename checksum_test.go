@@ -0,0 +1,49 @@
+package honoka
+
+import (
+    "io/ioutil"
+    "testing"
+)
+
+func corruptBucket(t *testing.T, cli *Client, key string) {
+    idx, exists := cli.lookup(key)
+    if !exists {
+        t.Fatalf("index entry is not found: %s", key)
+    }
+    path, _ := fileStore(cli).getBucketPath(idx.Bucket)
+    if err := ioutil.WriteFile(path, []byte("\"foob"), 0644); err != nil {
+        t.Fatalf("occurred error when corrupt bucket: %v", err)
+    }
+}
+
+func TestChecksum(t *testing.T) {
+    cli := newTestClient(t)
+    if err := cli.Set("testChecksum", "foobar", 100); err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+    corruptBucket(t, cli, "testChecksum")
+
+    _, err := cli.GetJson("testChecksum")
+    if err != ErrCorrupted {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, ErrCorrupted)
+    }
+}
+
+func TestCorruptionAsMiss(t *testing.T) {
+    cli := newTestClient(t, WithCorruptionAsMiss())
+    if err := cli.Set("testChecksum", "foobar", 100); err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+    corruptBucket(t, cli, "testChecksum")
+
+    updater := func() (interface{}, error) {
+        return "refreshed", nil
+    }
+    b, err := cli.UpdateJson("testChecksum", updater, 100)
+    if err != nil {
+        t.Errorf("occurred error when update cache: %v", err)
+    }
+    if string(b) != "\"refreshed\"" {
+        t.Errorf("actual does not match expected. actual: %s , expected: %s", b, "\"refreshed\"")
+    }
+}
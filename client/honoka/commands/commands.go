@@ -3,8 +3,11 @@ package commands
 import (
     "fmt"
     "os"
+    "time"
 
     "github.com/spf13/cobra"
+    "github.com/YusukeKomatsu/honoka"
+    "github.com/YusukeKomatsu/honoka/boltstore"
 )
 
 var (
@@ -17,6 +20,9 @@ var (
             cmd.Usage()
         },
     }
+    rootDir   string
+    dbFile    string
+    namespace string
 )
 
 func Exit(err error, codes ...int) {
@@ -30,6 +36,36 @@ func Exit(err error, codes ...int) {
     os.Exit(code)
 }
 
+// newClient returns a cache client for the database given by --db, or for
+// the directory given by --dir, falling back to $HONOKA_DIR or ~/.honoka.
+// The client uses the namespace given by --namespace.
+func newClient() (*honoka.Client, error) {
+    var opts []honoka.Option
+    if dbFile != "" {
+        opts = append(opts, boltstore.With(dbFile, 0644, 10 * time.Second))
+    } else {
+        opts = dirOptions()
+    }
+    if namespace != "" {
+        opts = append(opts, honoka.WithNamespace(namespace))
+    }
+    return honoka.New(opts...)
+}
+
+func dirOptions() []honoka.Option {
+    var opts []honoka.Option
+    if rootDir != "" {
+        opts = append(opts, honoka.WithDir(rootDir))
+    }
+    return opts
+}
+
 func Run() {
     RootCmd.Execute()
 }
+
+func init() {
+    RootCmd.PersistentFlags().StringVar(&rootDir, "dir", "", "cache root directory (default $"+honoka.EnvDir+" or ~/.honoka)")
+    RootCmd.PersistentFlags().StringVar(&dbFile, "db", "", "use single-file database instead of cache root directory")
+    RootCmd.PersistentFlags().StringVar(&namespace, "namespace", "", "use named cache instead of default one")
+}
@@ -3,33 +3,46 @@ package commands
 import (
     "fmt"
     "github.com/spf13/cobra"
-    "github.com/YusukeKomatsu/honoka"
 )
 
 var (
     deleteCmd = &cobra.Command{
-        Use:   "delete [key]",
+        Use:   "delete [key]...",
         Short: "Delete cache",
-        Long:  "Delete cache",
+        Long:  "Delete cache. With --match, delete every cache whose key matches the pattern.",
         Run:   deleteCommand,
     }
+    deleteMatch string
 )
 
 func deleteCommand(cmd *cobra.Command, args []string) {
-    if len(args) == 0 {
+    if len(args) == 0 && deleteMatch == "" {
         Exit(fmt.Errorf("Set cache keys"))
     }
-    cli, err := honoka.New()
+    cli, err := newClient()
     if err != nil {
         Exit(err)
     }
-    err = cli.Delete(args[0])
+    if deleteMatch != "" {
+        deleted, err := cli.DeleteMatching(deleteMatch)
+        if err != nil {
+            Exit(err)
+        }
+        for _, key := range deleted {
+            fmt.Printf("%s: deleted\n", key)
+        }
+    }
+    deleted, err := cli.DeleteMulti(args)
     if err != nil {
         Exit(err)
     }
+    for _, key := range deleted {
+        fmt.Printf("%s: deleted\n", key)
+    }
     fmt.Println("success.")
 }
 
 func init() {
+    deleteCmd.Flags().StringVar(&deleteMatch, "match", "", "delete caches whose key matches pattern ('*' and '?' are wildcards)")
     RootCmd.AddCommand(deleteCmd)
 }
\ No newline at end of file
@@ -19,16 +19,20 @@ func getCommand(cmd *cobra.Command, args []string) {
     if len(args) == 0 {
         Exit(fmt.Errorf("Set cache keys"))
     }
-    cli, err := honoka.New()
+    cli, err := newClient()
     if err != nil {
         Exit(err)
     }
+    values, err := cli.GetMulti(args)
+    errs, _ := err.(honoka.MultiError)
+    if err != nil && errs == nil {
+        Exit(err)
+    }
     for _, key := range args {
-        val, err := cli.GetJson(key)
-        if err != nil {
-            fmt.Printf("%s: %v\n", key, err)
-        } else {
+        if val, found := values[key]; found {
             fmt.Printf("%s: %v\n", key, string(val))
+        } else {
+            fmt.Printf("%s: %v\n", key, errs[key])
         }
     }
 }
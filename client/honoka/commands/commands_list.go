@@ -2,8 +2,8 @@ package commands
 
 import (
     "github.com/spf13/cobra"
-    "github.com/YusukeKomatsu/honoka"
     "github.com/davecgh/go-spew/spew"
+    "github.com/YusukeKomatsu/honoka"
 )
 
 var (
@@ -13,15 +13,21 @@ var (
         Long:  "Retrive cache index list (not include cache data). If you get cache, use get method",
         Run:   listCommand,
     }
+    listMatch string
 )
 
 func listCommand(cmd *cobra.Command, args []string) {
-    cli, err := honoka.New()
+    cli, err := newClient()
     if err != nil {
         Exit(err)
     }
 
-    list, err := cli.List()
+    var list []honoka.Index
+    if listMatch != "" {
+        list, err = cli.ListMatching(listMatch)
+    } else {
+        list, err = cli.List()
+    }
     if err != nil {
         Exit(err)
     }
@@ -29,5 +35,6 @@ func listCommand(cmd *cobra.Command, args []string) {
 }
 
 func init() {
+    listCmd.Flags().StringVar(&listMatch, "match", "", "list only keys matching pattern ('*' and '?' are wildcards)")
     RootCmd.AddCommand(listCmd)
 }
\ No newline at end of file
@@ -0,0 +1,61 @@
+package commands
+
+import (
+    "fmt"
+    "time"
+    "github.com/spf13/cobra"
+    "github.com/YusukeKomatsu/honoka"
+    "github.com/YusukeKomatsu/honoka/boltstore"
+)
+
+var (
+    migrateCmd = &cobra.Command{
+        Use:   "migrate [database file]",
+        Short: "Copy cache data into single-file database",
+        Long:  "Copy cache data from the directory layout (see --dir) into single-file database. Use the database with --db. Every namespace is copied along with the default one; with --namespace, only that namespace is copied.",
+        Run:   migrateCommand,
+    }
+)
+
+func migrateCommand(cmd *cobra.Command, args []string) {
+    if len(args) == 0 {
+        Exit(fmt.Errorf("Set database file"))
+    }
+    cli, err := honoka.New(dirOptions()...)
+    if err != nil {
+        Exit(err)
+    }
+    db, err := boltstore.Open(args[0], 0644, 10 * time.Second)
+    if err != nil {
+        Exit(err)
+    }
+    defer db.Close()
+    files := honoka.NewFileStore(cli.Dir())
+    names := []string{namespace}
+    if namespace == "" {
+        list, err := files.Namespaces()
+        if err != nil {
+            Exit(err)
+        }
+        names = append(names, list...)
+    }
+    for _, name := range names {
+        var dst, src honoka.Store = db, files
+        if name != "" {
+            if dst, err = db.Namespace(name); err != nil {
+                Exit(err)
+            }
+            if src, err = files.Namespace(name); err != nil {
+                Exit(err)
+            }
+        }
+        if err = honoka.Migrate(dst, src); err != nil {
+            Exit(err)
+        }
+    }
+    fmt.Println("success.")
+}
+
+func init() {
+    RootCmd.AddCommand(migrateCmd)
+}
@@ -0,0 +1,38 @@
+package commands
+
+import (
+    "fmt"
+    "github.com/spf13/cobra"
+)
+
+var (
+    namespacesCmd = &cobra.Command{
+        Use:   "namespaces",
+        Short: "Retrive namespace list",
+        Long:  "Retrive namespace list with number of caches and size of cache data in each namespace",
+        Run:   namespacesCommand,
+    }
+)
+
+func namespacesCommand(cmd *cobra.Command, args []string) {
+    cli, err := newClient()
+    if err != nil {
+        Exit(err)
+    }
+
+    list, err := cli.Namespaces()
+    if err != nil {
+        Exit(err)
+    }
+    for _, ns := range list {
+        name := ns.Name
+        if name == "" {
+            name = "(default)"
+        }
+        fmt.Printf("%s\t%d entries\t%d bytes\n", name, ns.Entries, ns.Bytes)
+    }
+}
+
+func init() {
+    RootCmd.AddCommand(namespacesCmd)
+}
@@ -3,7 +3,6 @@ package commands
 import (
     "fmt"
     "github.com/spf13/cobra"
-    "github.com/YusukeKomatsu/honoka"
 )
 
 var (
@@ -16,7 +15,7 @@ var (
 )
 
 func outdatedCommand(cmd *cobra.Command, args []string) {
-    cli, err := honoka.New()
+    cli, err := newClient()
     if err != nil {
         Exit(err)
     }
@@ -4,31 +4,39 @@ import (
     "fmt"
     "strconv"
     "github.com/spf13/cobra"
-    "github.com/YusukeKomatsu/honoka"
 )
 
 var (
     setCmd = &cobra.Command{
-        Use:   "set [key] [value] [expire]",
+        Use:   "set [key] [value] ([key] [value]...) [expire]",
         Short: "Cache new data",
-        Long:  "Cache new data if specified key is not used yet or caches (use specified key) are expired.",
+        Long:  "Cache new data if specified key is not used yet or caches (use specified key) are expired. Several keys can be set at once with the same expire.",
         Run:   setCommand,
     }
 )
 
 func setCommand(cmd *cobra.Command, args []string) {
-    if len(args) < 3 {
+    if len(args) < 3 || len(args) % 2 == 0 {
         Exit(fmt.Errorf("Set invalid argments"))
     }
-    cli, err := honoka.New()
+    cli, err := newClient()
     if err != nil {
         Exit(err)
     }
-    expire, _ := strconv.ParseInt(args[2], 10, 64)
-    err = cli.Set(args[0], args[1], expire)
+    expire, _ := strconv.ParseInt(args[len(args)-1], 10, 64)
+    items := make(map[string]interface{})
+    for i := 0; i < len(args)-1; i += 2 {
+        items[args[i]] = args[i+1]
+    }
+    written, err := cli.SetMulti(items, expire)
     if err != nil {
         Exit(err)
     }
+    for i := 0; i < len(args)-1; i += 2 {
+        if !written[args[i]] {
+            fmt.Printf("%s: not set, still cached\n", args[i])
+        }
+    }
     fmt.Println("success.")
 }
 
@@ -0,0 +1,61 @@
+package commands
+
+import (
+    "fmt"
+    "github.com/spf13/cobra"
+)
+
+var (
+    verifyCmd = &cobra.Command{
+        Use:   "verify",
+        Short: "Audit index and bucket data",
+        Long:  "Audit index and bucket data. Report index entries without bucket, broken buckets, expired caches and no-indexed buckets.",
+        Run:   verifyCommand,
+    }
+    verifyFix bool
+)
+
+func verifyCommand(cmd *cobra.Command, args []string) {
+    cli, err := newClient()
+    if err != nil {
+        Exit(err)
+    }
+    report, err := cli.Verify(verifyFix)
+    if err != nil {
+        Exit(err)
+    }
+    if report.OK() {
+        fmt.Println("No problem found.")
+        return
+    }
+    for _, idx := range report.Missing {
+        fmt.Printf("%s: missing bucket %s\n", idx.Key, idx.Bucket)
+    }
+    for _, issue := range report.Corrupted {
+        fmt.Printf("%s: broken bucket %s (Error [%v])\n", issue.Index.Key, issue.Index.Bucket, issue.Error)
+    }
+    for _, idx := range report.Expired {
+        fmt.Printf("%s: expired\n", idx.Key)
+    }
+    for _, bucket := range report.Orphaned {
+        fmt.Printf("%s: no-indexed bucket\n", bucket)
+    }
+    for _, idx := range report.Removed {
+        if idx.Key == "" {
+            fmt.Printf("%s: removed bucket\n", idx.Bucket)
+            continue
+        }
+        fmt.Printf("%s: removed\n", idx.Key)
+    }
+    if !verifyFix && len(report.Orphaned) > 0 {
+        fmt.Println("Use --fix or cleanup to delete no-indexed buckets.")
+    }
+    if !verifyFix && (len(report.Missing) > 0 || len(report.Corrupted) > 0) {
+        Exit(fmt.Errorf("Found broken caches. Use --fix to remove them"), 1)
+    }
+}
+
+func init() {
+    verifyCmd.Flags().BoolVar(&verifyFix, "fix", false, "remove index entries without bucket, broken buckets, expired caches and no-indexed buckets")
+    RootCmd.AddCommand(verifyCmd)
+}
@@ -0,0 +1,221 @@
+package honoka
+
+import (
+    "bytes"
+    "encoding/gob"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "sync"
+)
+
+// Codec serializes cache values into bucket payloads.
+// Its name is recorded in the Index so that reads pick the right decoder.
+type Codec interface {
+    // Name identifies the codec in the Index. It must be unique.
+    Name() string
+
+    Marshal(v interface{}) ([]byte, error)
+
+    Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+    // JSONCodec encodes values with encoding/json. It is the default.
+    JSONCodec Codec = jsonCodec{}
+
+    // GobCodec encodes values with encoding/gob. Reading a gob cache needs
+    // a concrete type, e.g. through the package function Get; the untyped
+    // methods such as Client.Get and Client.Update fail with
+    // ErrCodecNeedsType.
+    GobCodec  Codec = gobCodec{}
+
+    // RawCodec stores []byte and string values as they are.
+    RawCodec  Codec = rawCodec{}
+
+    // ErrUnknownCodec is returned when an Index names a codec that is not
+    // registered.
+    ErrUnknownCodec = errors.New("honoka: unknown codec")
+
+    // ErrCodecNeedsType is returned by the untyped methods, which decode
+    // into interface{}, for caches of a codec that needs a concrete type.
+    // Client.Update returns it before calling the UpdateFunc.
+    ErrCodecNeedsType = errors.New("honoka: codec needs a concrete type, use the typed functions such as Get[T]")
+
+    codecsMu sync.RWMutex
+    codecs   = map[string]Codec{}
+)
+
+func init() {
+    RegisterCodec(JSONCodec)
+    RegisterCodec(GobCodec)
+    RegisterCodec(RawCodec)
+}
+
+// RegisterCodec makes codec available for reading caches that were
+// written with it. Registering a name twice replaces the earlier codec.
+func RegisterCodec(codec Codec) {
+    codecsMu.Lock()
+    defer codecsMu.Unlock()
+    codecs[codec.Name()] = codec
+}
+
+func lookupCodec(name string) (Codec, error) {
+    if name == "" {
+        return JSONCodec, nil
+    }
+    codecsMu.RLock()
+    defer codecsMu.RUnlock()
+    codec, exists := codecs[name]
+    if !exists {
+        return nil, fmt.Errorf("%w: %q", ErrUnknownCodec, name)
+    }
+    return codec, nil
+}
+
+// WithCodec sets the codec used for values written by Set and Update.
+// UseCodec overrides it per call. Caches of GobCodec can only be read back
+// through the typed functions.
+//
+// Example:
+//   cli, err := honoka.New(honoka.WithCodec(honoka.GobCodec))
+func WithCodec(codec Codec) Option {
+    return func(c *Client) error {
+        if codec == nil {
+            return errors.New("honoka: codec must not be nil")
+        }
+        c.codec = codec
+        return nil
+    }
+}
+
+// UseCodec sets the codec for the value written by a single Set or Update.
+func UseCodec(codec Codec) CallOption {
+    return func(o *callOptions) {
+        o.codec = codec
+    }
+}
+
+func (c *Client) codecFor(o callOptions) Codec {
+    if o.codec != nil {
+        return o.codec
+    }
+    return c.codec
+}
+
+// typedCodec is implemented by codecs that cannot decode into interface{}.
+type typedCodec interface {
+    needsType()
+}
+
+func needsType(codec Codec) bool {
+    _, typed := codec.(typedCodec)
+    return typed
+}
+
+// cached is a bucket payload together with the codec that encoded it.
+type cached struct {
+    data    []byte
+    codec   Codec
+    version uint64
+}
+
+func (v cached) copy() cached {
+    if v.data != nil {
+        v.data = append([]byte(nil), v.data...)
+    }
+    return v
+}
+
+// json returns the payload as JSON, converting it through interface{} if
+// it was written with another codec.
+func (v cached) json() ([]byte, error) {
+    if v.codec == nil || v.codec.Name() == JSONCodec.Name() {
+        return v.data, nil
+    }
+    if needsType(v.codec) {
+        return nil, ErrCodecNeedsType
+    }
+    var val interface{}
+    if err := v.codec.Unmarshal(v.data, &val); err != nil {
+        return nil, err
+    }
+    return json.Marshal(val)
+}
+
+// loadCached reads the bucket of idx.
+func (c *Client) loadCached(idx Index) (cached, error) {
+    codec, err := lookupCodec(idx.Codec)
+    if err != nil {
+        return cached{}, err
+    }
+    data, err := c.getCacheFromBucket(idx)
+    if err != nil {
+        return cached{}, err
+    }
+    return cached{data: data, codec: codec, version: idx.Version}, nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+    return "json"
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+    return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+    return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string {
+    return "gob"
+}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+    var buf bytes.Buffer
+    if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+        return nil, err
+    }
+    return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+    return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+func (gobCodec) needsType() {}
+
+type rawCodec struct{}
+
+func (rawCodec) Name() string {
+    return "raw"
+}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+    switch val := v.(type) {
+    case []byte:
+        return val, nil
+    case string:
+        return []byte(val), nil
+    }
+    return nil, fmt.Errorf("honoka: raw codec cannot marshal %T", v)
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+    switch out := v.(type) {
+    case *[]byte:
+        *out = append([]byte(nil), data...)
+    case *string:
+        *out = string(data)
+    case *interface{}:
+        *out = append([]byte(nil), data...)
+    default:
+        return fmt.Errorf("honoka: raw codec cannot unmarshal into %T", v)
+    }
+    return nil
+}
@@ -0,0 +1,94 @@
+package honoka
+
+import (
+    "bytes"
+    "errors"
+    "testing"
+)
+
+func TestRawCodec(t *testing.T) {
+    cli := newTestClient(t)
+    expected := []byte{0x00, 0xca, 0xfe, 0xff}
+    err := cli.Set("testRaw", expected, 100, UseCodec(RawCodec))
+    if err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+
+    actual, err := Get[[]byte](cli, "testRaw")
+    if err != nil {
+        t.Fatalf("occurred error when get cache: %v", err)
+    }
+    if !bytes.Equal(actual, expected) {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", actual, expected)
+    }
+    list, _ := cli.List()
+    if len(list) != 1 || list[0].Codec != "raw" {
+        t.Errorf("codec is not recorded in index: %+v", list)
+    }
+}
+
+func TestGobCodec(t *testing.T) {
+    cli := newTestClient(t, WithCodec(GobCodec))
+    type payload struct {
+        Name string
+        Data []byte
+    }
+    f := func() (payload, error) {
+        return payload{Name: "honoka", Data: []byte{1, 2, 3}}, nil
+    }
+    for i := 0; i < 2; i++ {
+        actual, err := Update(cli, "testGob", f, 100)
+        if err != nil {
+            t.Fatalf("occurred error when update cache: %v", err)
+        }
+        if actual.Name != "honoka" || !bytes.Equal(actual.Data, []byte{1, 2, 3}) {
+            t.Errorf("actual does not match expected. actual: %+v", actual)
+        }
+    }
+}
+
+func TestGobCodecUntyped(t *testing.T) {
+    cli := newTestClient(t, WithCodec(GobCodec))
+    if err := cli.Set("testGob", "honoka", 100); err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+
+    var output interface{}
+    if _, err := cli.Get("testGob", &output); err != ErrCodecNeedsType {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, ErrCodecNeedsType)
+    }
+    if _, err := cli.GetJson("testGob"); err != ErrCodecNeedsType {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, ErrCodecNeedsType)
+    }
+    if _, err := cli.GetMulti([]string{"testGob"}); err.(MultiError)["testGob"] != ErrCodecNeedsType {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, ErrCodecNeedsType)
+    }
+
+    called := false
+    updater := func() (interface{}, error) {
+        called = true
+        return "updated", nil
+    }
+    if _, err := cli.Update("testGobUpdate", updater, 100, &output); err != ErrCodecNeedsType {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, ErrCodecNeedsType)
+    }
+    if _, err := cli.UpdateJson("testGobUpdate", updater, 100); err != ErrCodecNeedsType {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, ErrCodecNeedsType)
+    }
+    if called {
+        t.Errorf("updater is called although its result cannot be returned")
+    }
+
+    actual, err := Get[string](cli, "testGob")
+    if err != nil || actual != "honoka" {
+        t.Errorf("actual does not match expected. actual: %s (%v) , expected: %s", actual, err, "honoka")
+    }
+}
+
+func TestUnknownCodec(t *testing.T) {
+    cli := newTestClient(t)
+    _, err := cli.loadCached(Index{Bucket: "foobar", Codec: "nope"})
+    if !errors.Is(err, ErrUnknownCodec) {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, ErrUnknownCodec)
+    }
+}
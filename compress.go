@@ -0,0 +1,132 @@
+package honoka
+
+import (
+    "bytes"
+    "compress/gzip"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "sync"
+)
+
+// Compressor compresses bucket files. Its name is recorded in the Index so
+// that caches with mixed compression read correctly.
+type Compressor interface {
+    // Name identifies the compression in the Index. It must be unique.
+    Name() string
+
+    Compress(data []byte) ([]byte, error)
+
+    Decompress(data []byte) ([]byte, error)
+}
+
+var (
+    // GzipCompressor compresses buckets with compress/gzip at the default
+    // level.
+    GzipCompressor Compressor = NewGzipCompressor(gzip.DefaultCompression)
+
+    // ErrUnknownCompression is returned when an Index names a compression
+    // that is not registered.
+    ErrUnknownCompression = errors.New("honoka: unknown compression")
+
+    compressorsMu sync.RWMutex
+    compressors   = map[string]Compressor{}
+)
+
+func init() {
+    RegisterCompressor(GzipCompressor)
+}
+
+// RegisterCompressor makes compressor available for reading buckets that
+// were written with it. Registering a name twice replaces the earlier one.
+func RegisterCompressor(compressor Compressor) {
+    compressorsMu.Lock()
+    defer compressorsMu.Unlock()
+    compressors[compressor.Name()] = compressor
+}
+
+// WithCompression compresses buckets whose payload is at least threshold
+// bytes with compressor. Smaller payloads are stored as they are.
+//
+// Example:
+//   cli, err := honoka.New(honoka.WithCompression(honoka.GzipCompressor, 1024))
+func WithCompression(compressor Compressor, threshold int) Option {
+    return func(c *Client) error {
+        if compressor == nil {
+            return errors.New("honoka: compressor must not be nil")
+        }
+        if threshold < 0 {
+            return errors.New("honoka: compression threshold must not be negative")
+        }
+        c.compressor = compressor
+        c.compressMin = threshold
+        return nil
+    }
+}
+
+// compress compresses data if the client is configured to and records the
+// compression in idx.
+func (c *Client) compress(idx *Index, data []byte) ([]byte, error) {
+    idx.Compression = ""
+    if c.compressor == nil || len(data) < c.compressMin {
+        return data, nil
+    }
+    compressed, err := c.compressor.Compress(data)
+    if err != nil {
+        return nil, err
+    }
+    idx.Compression = c.compressor.Name()
+    return compressed, nil
+}
+
+func decompress(name string, data []byte) ([]byte, error) {
+    if name == "" {
+        return data, nil
+    }
+    compressorsMu.RLock()
+    compressor, exists := compressors[name]
+    compressorsMu.RUnlock()
+    if !exists {
+        return nil, fmt.Errorf("%w: %q", ErrUnknownCompression, name)
+    }
+    return compressor.Decompress(data)
+}
+
+type gzipCompressor struct {
+    level int
+}
+
+// NewGzipCompressor returns a gzip Compressor with the given level
+// (see compress/gzip). It shares its name with GzipCompressor, since any
+// level is read back the same way.
+func NewGzipCompressor(level int) Compressor {
+    return gzipCompressor{level: level}
+}
+
+func (gzipCompressor) Name() string {
+    return "gzip"
+}
+
+func (g gzipCompressor) Compress(data []byte) ([]byte, error) {
+    var buf bytes.Buffer
+    w, err := gzip.NewWriterLevel(&buf, g.level)
+    if err != nil {
+        return nil, err
+    }
+    if _, err = w.Write(data); err != nil {
+        return nil, err
+    }
+    if err = w.Close(); err != nil {
+        return nil, err
+    }
+    return buf.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(data []byte) ([]byte, error) {
+    r, err := gzip.NewReader(bytes.NewReader(data))
+    if err != nil {
+        return nil, err
+    }
+    defer r.Close()
+    return ioutil.ReadAll(r)
+}
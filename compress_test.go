@@ -0,0 +1,46 @@
+package honoka
+
+import (
+    "io/ioutil"
+    "strings"
+    "testing"
+)
+
+func TestCompression(t *testing.T) {
+    cli := newTestClient(t, WithCompression(GzipCompressor, 64))
+    large := strings.Repeat("honoka", 1000)
+
+    if err := cli.Set("testLarge", large, 100); err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+    if err := cli.Set("testSmall", "foobar", 100); err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+
+    for key, expected := range map[string]string{"testLarge": "gzip", "testSmall": ""} {
+        idx, _ := cli.lookup(key)
+        if idx.Compression != expected {
+            t.Errorf("actual does not match expected. actual: %q , expected: %q", idx.Compression, expected)
+        }
+    }
+
+    idx, _ := cli.lookup("testLarge")
+    path, _ := fileStore(cli).getBucketPath(idx.Bucket)
+    b, err := ioutil.ReadFile(path)
+    if err != nil {
+        t.Fatalf("occurred error when read bucket: %v", err)
+    }
+    if len(b) >= len(large) {
+        t.Errorf("bucket is not compressed: %d bytes", len(b))
+    }
+
+    // A client without compression still reads the compressed bucket.
+    plain := newTestClient(t, WithDir(cli.Dir()))
+    actual, err := Get[string](plain, "testLarge")
+    if err != nil {
+        t.Fatalf("occurred error when get cache: %v", err)
+    }
+    if actual != large {
+        t.Errorf("actual does not match expected. actual: %d bytes , expected: %d bytes", len(actual), len(large))
+    }
+}
@@ -0,0 +1,147 @@
+package honoka
+
+import (
+    "strconv"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+// Run with -race to catch unsynchronized access to the index.
+func TestConcurrentAccess(t *testing.T) {
+    cli := newTestClient(t)
+    updater := func() (interface{}, error) {
+        return "updated", nil
+    }
+
+    var wg sync.WaitGroup
+    for g := 0; g < 16; g++ {
+        wg.Add(1)
+        go func(g int) {
+            defer wg.Done()
+            for i := 0; i < 20; i++ {
+                key := "key" + strconv.Itoa((g+i)%5)
+                switch i % 6 {
+                case 0:
+                    if err := cli.Set(key, i, 100); err != nil {
+                        t.Errorf("occurred error when set cache: %v", err)
+                    }
+                case 1:
+                    var output interface{}
+                    cli.Get(key, &output)
+                case 2:
+                    if _, err := cli.UpdateJson(key, updater, 100); err != nil {
+                        t.Errorf("occurred error when update cache: %v", err)
+                    }
+                case 3:
+                    if err := cli.Delete(key); err != nil {
+                        t.Errorf("occurred error when delete cache: %v", err)
+                    }
+                case 4:
+                    if _, err := cli.Clean(); err != nil {
+                        t.Errorf("occurred error when clean cache: %v", err)
+                    }
+                case 5:
+                    cli.Expire(key)
+                    if _, err := cli.List(); err != nil {
+                        t.Errorf("occurred error when list cache: %v", err)
+                    }
+                }
+            }
+        }(g)
+    }
+    wg.Wait()
+}
+
+func TestUpdateSharesRefresh(t *testing.T) {
+    cli := newTestClient(t)
+    var calls int32
+    release := make(chan struct{})
+    updater := func() (interface{}, error) {
+        atomic.AddInt32(&calls, 1)
+        <-release
+        return "shared", nil
+    }
+
+    var wg sync.WaitGroup
+    for g := 0; g < 10; g++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            b, err := cli.UpdateJson("testShared", updater, 100)
+            if err != nil {
+                t.Errorf("occurred error when update cache: %v", err)
+            }
+            if string(b) != "\"shared\"" {
+                t.Errorf("actual does not match expected. actual: %s , expected: %s", b, "\"shared\"")
+            }
+        }()
+    }
+    time.Sleep(50 * time.Millisecond)
+    close(release)
+    wg.Wait()
+
+    if calls != 1 {
+        t.Errorf("actual does not match expected. actual: %d , expected: %d", calls, 1)
+    }
+
+    _, err := cli.UpdateJson("testShared", updater, 100, ForceRefresh())
+    if err != nil {
+        t.Errorf("occurred error when update cache: %v", err)
+    }
+    if calls != 2 {
+        t.Errorf("ForceRefresh did not call updater. calls: %d", calls)
+    }
+    outdated, err := cli.Outdated()
+    if err != nil || len(outdated) != 0 {
+        t.Errorf("replaced buckets are left behind: %v (%v)", outdated, err)
+    }
+}
+
+// Put deletes the bucket it replaced, which a concurrent read may be about
+// to open. Such a read has to move on to the new entry.
+func TestGetDuringPut(t *testing.T) {
+    cli := newTestClient(t)
+    if err := cli.Put("testRace", 0, 100); err != nil {
+        t.Fatalf("occurred error when put cache: %v", err)
+    }
+    updater := func() (interface{}, error) {
+        return "updated", nil
+    }
+
+    stop := make(chan struct{})
+    var wg sync.WaitGroup
+    for g := 0; g < 8; g++ {
+        wg.Add(1)
+        go func(g int) {
+            defer wg.Done()
+            for {
+                select {
+                case <-stop:
+                    return
+                default:
+                }
+                var err error
+                if g%2 == 0 {
+                    _, err = cli.GetJson("testRace")
+                } else {
+                    _, err = cli.UpdateJson("testRace", updater, 100)
+                }
+                if err != nil {
+                    t.Errorf("occurred error when read cache during put: %v", err)
+                    return
+                }
+            }
+        }(g)
+    }
+    deadline := time.Now().Add(500 * time.Millisecond)
+    for i := 1; time.Now().Before(deadline); i++ {
+        if err := cli.Put("testRace", i, 100); err != nil {
+            t.Errorf("occurred error when put cache: %v", err)
+            break
+        }
+    }
+    close(stop)
+    wg.Wait()
+}
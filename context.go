@@ -0,0 +1,99 @@
+package honoka
+
+import (
+    "context"
+)
+
+// UpdateContextFunc is an UpdateFunc that receives the context of the call
+// that triggered the refresh. It should give up when ctx is done; its
+// result is discarded then.
+type UpdateContextFunc func(ctx context.Context) (interface{}, error)
+
+// GetContext is Get that gives up when ctx is done.
+//
+// Example:
+//   ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+//   defer cancel()
+//   var output interface{}
+//   result, err := cli.GetContext(ctx, "foobar", &output)
+func (c *Client) GetContext(ctx context.Context, key string, output interface{}) (interface{}, error) {
+    result, _, err := c.fetchValue(ctx, key)
+    if err != nil {
+        return nil, err
+    }
+    return weakDecodeValue(result, output)
+}
+
+// GetJsonContext is GetJson that gives up when ctx is done.
+func (c *Client) GetJsonContext(ctx context.Context, key string) ([]byte, error) {
+    v, err := c.fetch(ctx, key)
+    if err != nil {
+        return nil, err
+    }
+    return v.json()
+}
+
+// SetContext is Set that gives up when ctx is done before the cache is
+// written, for example while waiting for the index lock.
+func (c *Client) SetContext(ctx context.Context, key string, val interface{}, expire int64, opts ...CallOption) error {
+    _, err := c.set(ctx, key, val, expire, ifInvalid, newCallOptions(opts))
+    return err
+}
+
+// SetNXContext is SetNX with the cancellation of SetContext.
+func (c *Client) SetNXContext(ctx context.Context, key string, val interface{}, expire int64, opts ...CallOption) (bool, error) {
+    return c.set(ctx, key, val, expire, ifInvalid, newCallOptions(opts))
+}
+
+// PutContext is Put with the cancellation of SetContext.
+func (c *Client) PutContext(ctx context.Context, key string, val interface{}, expire int64, opts ...CallOption) error {
+    _, err := c.set(ctx, key, val, expire, always, newCallOptions(opts))
+    return err
+}
+
+// UpdateContext is Update that passes ctx to updater and gives up when ctx
+// is done, whether it is waiting for the index lock, for a refresh of the
+// same key by another caller or for updater itself. A refresh cancelled
+// this way writes nothing.
+//
+// Example:
+//   f := func(ctx context.Context) (interface{}, error) { return fetchRepository(ctx, "honoka") }
+//   var output interface{}
+//   result, err := cli.UpdateContext(r.Context(), "foobar", f, 100, &output)
+func (c *Client) UpdateContext(ctx context.Context, key string, updater UpdateContextFunc, expire int64, output interface{}, opts ...CallOption) (interface{}, error) {
+    b, err := c.UpdateJsonContext(ctx, key, updater, expire, opts...)
+    if b != nil {
+        result, e := weakDecode(b, output)
+        if e != nil {
+            return nil, e
+        }
+        return result, err
+    }
+
+    return output, err
+}
+
+// UpdateJsonContext is UpdateJson with the cancellation of UpdateContext.
+func (c *Client) UpdateJsonContext(ctx context.Context, key string, updater UpdateContextFunc, expire int64, opts ...CallOption) ([]byte, error) {
+    o := newCallOptions(opts)
+    if needsType(c.codecFor(o)) {
+        // The result could be written but not returned.
+        return nil, ErrCodecNeedsType
+    }
+    v, err := c.update(ctx, key, updater, expire, o)
+    if v.data == nil {
+        return nil, err
+    }
+    o.reportVersion(v.version)
+    b, e := v.json()
+    if e != nil {
+        return nil, e
+    }
+    return b, err
+}
+
+// DeleteContext is Delete that gives up waiting for the index lock when
+// ctx is done.
+func (c *Client) DeleteContext(ctx context.Context, key string) error {
+    return c.deleteIf(ctx, key, nil)
+}
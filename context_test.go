@@ -0,0 +1,131 @@
+package honoka
+
+import (
+    "context"
+    "testing"
+    "time"
+)
+
+func TestUpdateContextCancelled(t *testing.T) {
+    cli := newTestClient(t)
+    ctx, cancel := context.WithCancel(context.Background())
+    started := make(chan struct{})
+    updater := func(ctx context.Context) (interface{}, error) {
+        close(started)
+        <-ctx.Done()
+        return nil, ctx.Err()
+    }
+    go func() {
+        <-started
+        cancel()
+    }()
+
+    if _, err := cli.UpdateJsonContext(ctx, "testCancelled", updater, 100); err != context.Canceled {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, context.Canceled)
+    }
+    if _, exists := cli.lookup("testCancelled"); exists {
+        t.Errorf("cancelled refresh is stored")
+    }
+}
+
+func TestUpdateContextDiscardsLateResult(t *testing.T) {
+    cli := newTestClient(t)
+    ctx, cancel := context.WithCancel(context.Background())
+    // The updater ignores ctx and finishes after the call was cancelled.
+    updater := func(context.Context) (interface{}, error) {
+        cancel()
+        return "fizzbizz", nil
+    }
+
+    if _, err := cli.UpdateJsonContext(ctx, "testLate", updater, 100); err != context.Canceled {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, context.Canceled)
+    }
+    if _, exists := cli.lookup("testLate"); exists {
+        t.Errorf("cancelled refresh is stored")
+    }
+    if buckets, _ := cli.store.ListBuckets(); len(buckets) != 0 {
+        t.Errorf("cancelled refresh wrote buckets: %v", buckets)
+    }
+}
+
+func TestSetContextLockWait(t *testing.T) {
+    cli := newTestClient(t, WithLockTimeout(10 * time.Second))
+    unlock, err := fileStore(cli).Lock(time.Second)
+    if err != nil {
+        t.Fatalf("occurred error when lock index: %v", err)
+    }
+    defer unlock()
+
+    ctx, cancel := context.WithTimeout(context.Background(), 50 * time.Millisecond)
+    defer cancel()
+    begin := time.Now()
+    if err = cli.SetContext(ctx, "testLockWait", "foobar", 100); err != context.DeadlineExceeded {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, context.DeadlineExceeded)
+    }
+    if elapsed := time.Since(begin); elapsed > 5 * time.Second {
+        t.Errorf("lock wait is not cancelled: %v", elapsed)
+    }
+}
+
+func TestUpdateContextFlightWait(t *testing.T) {
+    cli := newTestClient(t)
+    started := make(chan struct{})
+    release := make(chan struct{})
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        cli.UpdateJson("testFlight", func() (interface{}, error) {
+            close(started)
+            <-release
+            return "leader", nil
+        }, 100)
+    }()
+    <-started
+
+    ctx, cancel := context.WithTimeout(context.Background(), 50 * time.Millisecond)
+    defer cancel()
+    updater := func(context.Context) (interface{}, error) {
+        return "waiter", nil
+    }
+    if _, err := cli.UpdateJsonContext(ctx, "testFlight", updater, 100); err != context.DeadlineExceeded {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, context.DeadlineExceeded)
+    }
+    close(release)
+    <-done
+}
+
+func TestUpdateContextLeaderCancelled(t *testing.T) {
+    cli := newTestClient(t)
+    ctx, cancel := context.WithCancel(context.Background())
+    started := make(chan struct{})
+    done := make(chan error)
+    go func() {
+        _, err := cli.UpdateJsonContext(ctx, "testLeader", func(ctx context.Context) (interface{}, error) {
+            close(started)
+            <-ctx.Done()
+            return nil, ctx.Err()
+        }, 100)
+        done <- err
+    }()
+    <-started
+
+    result := make(chan string)
+    go func() {
+        v, err := UpdateContext(context.Background(), cli, "testLeader", func(context.Context) (string, error) {
+            return "waiter", nil
+        }, 100)
+        if err != nil {
+            t.Errorf("occurred error when update cache: %v", err)
+        }
+        result <- v
+    }()
+    time.Sleep(50 * time.Millisecond)
+    cancel()
+
+    if err := <-done; err != context.Canceled {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, context.Canceled)
+    }
+    if actual := <-result; actual != "waiter" {
+        t.Errorf("actual does not match expected. actual: %s , expected: %s", actual, "waiter")
+    }
+}
@@ -0,0 +1,279 @@
+package honoka
+
+import (
+    "context"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "time"
+)
+
+// FileStore keeps every bucket in a file under <Dir>/buckets, sharded into
+// two levels of subdirectories by the first bytes of its name
+// (buckets/ab/cd/abcd...), and the index
+// as a snapshot in <Dir>/index plus an append-only journal of changes in
+// <Dir>/index.journal, which is folded into the snapshot now and then.
+// Writes of a single key, and deletes of any number of keys, only append
+// those entries to the journal, so they do not depend on the size of the
+// index. The exception is a Client with WithMaxBytes or WithMaxEntries:
+// it needs the whole index for eviction, so each of its writes loads,
+// copies and diffs the index, though it still appends only the changes.
+// It is the default Store. Index updates are guarded by an advisory lock on
+// <Dir>/index.lock, so several processes can share a Dir.
+type FileStore struct {
+    // Root directory that holds the index file and buckets.
+    Dir      string
+
+    // Permission bits of the index and bucket files.
+    FileMode os.FileMode
+
+    // Permission bits of the directories.
+    DirMode  os.FileMode
+
+    // Number of journal records after which the index is compacted into
+    // a new snapshot. Zero means 1000.
+    MaxJournal int
+
+    // mu guards the replayed index below.
+    mu             sync.Mutex
+    state          IndexList
+    files          fileState
+    journalValid   int64
+    journalRecords int
+
+    // Highest version the index has held, see VersionStore.
+    maxVersion     uint64
+
+    // afterSnapshot is called by compact between writing the snapshot and
+    // emptying the journal, for tests.
+    afterSnapshot func()
+}
+
+// NewFileStore returns a FileStore rooted at dir with the default modes.
+func NewFileStore(dir string) *FileStore {
+    return &FileStore{
+        Dir:      dir,
+        FileMode: defaultFileMode,
+        DirMode:  defaultDirMode,
+    }
+}
+
+func (s *FileStore) ReadBucket(name string) ([]byte, error) {
+    path, err := s.getBucketPath(name)
+    if err != nil {
+        return nil, err
+    }
+    // The bucket may be deleted at any time by a write that replaced it,
+    // so a missing file is only known from ReadFile itself.
+    data, err := ioutil.ReadFile(path)
+    if os.IsNotExist(err) {
+        if err = s.migrateBucket(name); err != nil {
+            return nil, err
+        }
+        data, err = ioutil.ReadFile(path)
+    }
+    if os.IsNotExist(err) {
+        return nil, BucketFileNotFound
+    }
+    return data, err
+}
+
+func (s *FileStore) WriteBucket(name string, data []byte) error {
+    path, err := s.getBucketPath(name)
+    if err != nil {
+        return err
+    }
+    if err = os.MkdirAll(filepath.Dir(path), s.DirMode); err != nil {
+        return err
+    }
+    return writeFileAtomic(path, data, s.FileMode)
+}
+
+func (s *FileStore) DeleteBucket(name string) error {
+    path, err := s.getBucketPath(name)
+    if err != nil {
+        return err
+    }
+    for _, p := range []string{path, s.getFlatBucketPath(name)} {
+        err = os.Remove(p)
+        if err != nil && !os.IsNotExist(err) {
+            return err
+        }
+    }
+    return nil
+}
+
+// ListBuckets walks the shard directories. Buckets left in the flat layout
+// of older versions are moved into their shard on the way.
+func (s *FileStore) ListBuckets() ([]string, error) {
+    bucketsDir, err := s.getBucketsDirPath()
+    if err != nil {
+        return nil, err
+    }
+    var list []string
+    err = filepath.Walk(bucketsDir, func(path string, fi os.FileInfo, err error) error {
+        if err != nil {
+            if os.IsNotExist(err) {
+                return nil
+            }
+            return err
+        }
+        name := fi.Name()
+        if path == bucketsDir {
+            return nil
+        }
+        if strings.HasPrefix(name, ".") {
+            // temp files of writes in progress
+            return nil
+        }
+        if fi.IsDir() {
+            rel, _ := filepath.Rel(bucketsDir, path)
+            if strings.Count(rel, string(filepath.Separator)) >= shardDepth {
+                return filepath.SkipDir
+            }
+            return nil
+        }
+        if filepath.Dir(path) == bucketsDir && len(shardDirs(name)) > 0 {
+            if err := s.migrateBucket(name); err != nil {
+                return err
+            }
+        }
+        list = append(list, name)
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    return list, nil
+}
+
+// LoadIndex reads the snapshot and replays the journal on top of it.
+// It returns IndexFileNotFound if neither exists.
+func (s *FileStore) LoadIndex() (IndexList, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.loadIndex()
+}
+
+// SaveIndex appends the changes since the last load to the journal.
+func (s *FileStore) SaveIndex(idx IndexList) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.saveIndex(idx)
+}
+
+// Lock takes an advisory lock on <Dir>/index.lock, polling until timeout.
+func (s *FileStore) Lock(timeout time.Duration) (func(), error) {
+    return s.LockContext(context.Background(), timeout)
+}
+
+// LockContext is Lock that stops polling when ctx is done.
+func (s *FileStore) LockContext(ctx context.Context, timeout time.Duration) (func(), error) {
+    if err := os.MkdirAll(s.Dir, s.DirMode); err != nil {
+        return nil, err
+    }
+    path := filepath.Join(s.Dir, "index.lock")
+    deadline := time.Now().Add(timeout)
+    for {
+        l, err := lockFile(path, s.FileMode)
+        if err == nil {
+            return l.unlock, nil
+        }
+        if err != errLockBusy {
+            return nil, err
+        }
+        if !time.Now().Before(deadline) {
+            return nil, ErrLockTimeout
+        }
+        select {
+        case <-ctx.Done():
+            return nil, ctx.Err()
+        case <-time.After(lockRetryInterval):
+        }
+    }
+}
+
+func (s *FileStore) getBucketsDirPath() (string, error) {
+    bucketsDir := filepath.Join(s.Dir, "buckets")
+    err := os.MkdirAll(bucketsDir, s.DirMode)
+    return bucketsDir, err
+}
+
+func (s *FileStore) getBucketPath(bucketName string) (string, error) {
+    bucketsDir, err := s.getBucketsDirPath()
+    if err != nil {
+        return "", err
+    }
+    elems := append([]string{bucketsDir}, shardDirs(bucketName)...)
+    return filepath.Join(append(elems, bucketName)...), nil
+}
+
+// getFlatBucketPath returns where the bucket lived before buckets were
+// sharded.
+func (s *FileStore) getFlatBucketPath(bucketName string) string {
+    return filepath.Join(s.Dir, "buckets", bucketName)
+}
+
+// migrateBucket moves a bucket from the flat layout into its shard. It is
+// not an error if there is nothing to move.
+func (s *FileStore) migrateBucket(name string) error {
+    if len(shardDirs(name)) == 0 {
+        return nil
+    }
+    path, err := s.getBucketPath(name)
+    if err != nil {
+        return err
+    }
+    flat := s.getFlatBucketPath(name)
+    if !fileExists(flat) {
+        return nil
+    }
+    if fileExists(path) {
+        err = os.Remove(flat)
+    } else if err = os.MkdirAll(filepath.Dir(path), s.DirMode); err == nil {
+        err = os.Rename(flat, path)
+    }
+    if err != nil && !os.IsNotExist(err) {
+        return err
+    }
+    return nil
+}
+
+// shardDepth is the number of directory levels below buckets.
+const shardDepth = 2
+
+// shardDirs returns the subdirectories a bucket is placed in, two
+// characters each. Names too short to shard stay at the top level.
+func shardDirs(bucketName string) []string {
+    if len(bucketName) <= shardDepth*2 {
+        return nil
+    }
+    dirs := make([]string, shardDepth)
+    for i := range dirs {
+        dirs[i] = bucketName[i*2 : i*2+2]
+    }
+    return dirs
+}
+
+func (s *FileStore) getIndexPath() (string, error) {
+    err := os.MkdirAll(s.Dir, s.DirMode)
+    return filepath.Join(s.Dir, "index"), err
+}
+
+func (s *FileStore) getIndexFromFile() ([]byte, error) {
+    path, err := s.getIndexPath()
+    if err != nil {
+        return nil, err
+    }
+    if !fileExists(path) {
+        return nil, IndexFileNotFound
+    }
+    return ioutil.ReadFile(path)
+}
+
+func fileExists(filename string) bool {
+    _, err := os.Stat(filename)
+    return err == nil
+}
@@ -0,0 +1,68 @@
+package honoka
+
+import (
+    "context"
+    "errors"
+    "sync"
+)
+
+// errUpdaterPanicked is handed to callers waiting on a refresh whose
+// UpdateFunc panicked.
+var errUpdaterPanicked = errors.New("honoka: UpdateFunc panicked")
+
+// flightCall is an in-flight or completed refresh of one key.
+type flightCall struct {
+    done chan struct{}
+    val  cached
+    err  error
+}
+
+// flightGroup de-duplicates concurrent refreshes of the same key, so that
+// only one UpdateFunc runs and every waiter shares its result.
+type flightGroup struct {
+    mu    sync.Mutex
+    calls map[string]*flightCall
+}
+
+// do runs fn for key unless a call for key is already in flight, in which
+// case it waits for that call and returns a copy of its result. A waiter
+// stops waiting when ctx is done, and runs the refresh itself if the call
+// it waited for was cancelled by its own caller's context.
+func (g *flightGroup) do(ctx context.Context, key string, fn func() (cached, error)) (cached, error) {
+    for {
+        g.mu.Lock()
+        if g.calls == nil {
+            g.calls = make(map[string]*flightCall)
+        }
+        call, exists := g.calls[key]
+        if !exists {
+            break
+        }
+        g.mu.Unlock()
+        select {
+        case <-call.done:
+        case <-ctx.Done():
+            return cached{}, ctx.Err()
+        }
+        if isContextError(call.err) && ctx.Err() == nil {
+            continue
+        }
+        return call.val.copy(), call.err
+    }
+    call := &flightCall{done: make(chan struct{}), err: errUpdaterPanicked}
+    g.calls[key] = call
+    g.mu.Unlock()
+
+    defer func() {
+        g.mu.Lock()
+        delete(g.calls, key)
+        g.mu.Unlock()
+        close(call.done)
+    }()
+    call.val, call.err = fn()
+    return call.val, call.err
+}
+
+func isContextError(err error) bool {
+    return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -1,17 +1,17 @@
 package honoka
 
 import (
+    "context"
     "crypto/sha256"
     "encoding/hex"
     "encoding/json"
     "errors"
-    "io/ioutil"
     "os"
-    "path/filepath"
+    "reflect"
     "strconv"
+    "sync"
     "time"
 
-    homedir "github.com/mitchellh/go-homedir"
     "github.com/mitchellh/mapstructure"
 
     // for Debug
@@ -20,9 +20,76 @@ import (
 )
 
 // Cache client
+//
+// A Client is safe for concurrent use by multiple goroutines.
 type Client struct {
-    // Cache Index list
+    // Cache Index list.
+    // Client methods replace it or modify it in place under an internal
+    // lock, so read it through List rather than directly when the Client
+    // is shared.
     Indexer IndexList
+
+    // mu guards Indexer, together with the index lock for writes.
+    mu sync.RWMutex
+
+    // Persistence of the index and buckets.
+    store Store
+
+    // Store holding the default namespace, which is store itself unless
+    // a namespace is set.
+    root      Store
+    namespace string
+
+    // Root directory of the default FileStore.
+    dir      string
+    fileMode os.FileMode
+    dirMode  os.FileMode
+    now      func() time.Time
+
+    // How long index mutations wait for the index lock.
+    lockTimeout time.Duration
+
+    // De-duplicates concurrent refreshes of the same key.
+    flights flightGroup
+
+    // Seconds an expired bucket is still served by Update while it is
+    // refreshed in the background.
+    grace int64
+
+    // Seconds an expired bucket is kept as a fallback for failed refreshes.
+    staleIfError int64
+
+    // Codec for values written by Set and Update.
+    codec Codec
+
+    // Compression for buckets of at least compressMin bytes.
+    compressor  Compressor
+    compressMin int
+
+    // Treat corrupted buckets as cache misses instead of errors.
+    corruptionAsMiss bool
+
+    // Size limits enforced by evicting least recently used entries.
+    maxBytes   int64
+    maxEntries int
+
+    // Reads not yet written to the index, guarded by mu.
+    accessed map[string]int64
+
+    // Background purge of expired entries, see WithJanitor.
+    janitor *janitor
+
+    // In-process tier in front of the bucket files, see WithMemoryTier.
+    memory *memoryTier
+
+    // Receives the errors of background refreshes, see
+    // WithRefreshErrorHandler.
+    refreshError func(key string, err error)
+
+    // Keys being refreshed in the background, see Refreshing and Wait.
+    bgMu       sync.Mutex
+    background map[string]struct{}
+    bgWG       sync.WaitGroup
 }
 
 // Cache index list
@@ -38,6 +105,36 @@ type Index struct {
 
     // The maximum elapsed time since the last file update.
     Expiration int64
+
+    // Until this time an expired bucket is still served by Update while
+    // the UpdateFunc runs in the background. Zero means no grace window.
+    Grace      int64
+
+    // Until this time an expired bucket is kept and returned by Update,
+    // wrapped in a StaleError, when the refresh fails.
+    StaleIfError int64
+
+    // The name of the codec that encoded the bucket. Empty means JSON.
+    Codec      string
+
+    // The name of the compression applied to the bucket. Empty means none.
+    Compression string
+
+    // Hex encoded sha256 of the bucket file. Empty means unchecked.
+    Checksum   string
+
+    // The size of the bucket file in bytes.
+    Size       int64
+
+    // Increases with every write of the key. It also increases across
+    // deletes, and when the clock goes back, if the store remembers the
+    // highest version it held (see VersionStore), as the default stores
+    // do. Zero means the entry was written before versions were recorded.
+    Version    uint64
+
+    // The last time the cache was written or read, in unix nanoseconds.
+    // Reads are recorded only when size limits are set.
+    Accessed   int64
 }
 
 // The structure is used when use clean method.
@@ -51,16 +148,71 @@ type CleanResult struct {
 
 type UpdateFunc func() (interface{}, error)
 
+// withContext adapts f to an UpdateContextFunc that ignores its context.
+func (f UpdateFunc) withContext() UpdateContextFunc {
+    return func(context.Context) (interface{}, error) {
+        return f()
+    }
+}
+
 var (
     Version = "0.0.1"
     BucketFileNotFound = errors.New("Not found specified bucket file")
     IndexFileNotFound  = errors.New("Not found specified index file")
     CacheIsExpired     = errors.New("specified cache is expired")
+
+    // ErrCorrupted is returned when a bucket does not match the checksum
+    // recorded in its index entry.
+    ErrCorrupted       = errors.New("honoka: bucket is corrupted")
 )
 
-// New is a function for making a new cache
-func New() (*Client, error) {
-    idx, err := getIndexList()
+// New is a function for making a new cache.
+// The cache lives in $HONOKA_DIR, or ~/.honoka if it is not set,
+// unless WithDir is given.
+//
+// Example:
+//   cli, err := honoka.New()
+//   // OR
+//   cli, err := honoka.New(honoka.WithDir("/tmp/cache"), honoka.WithFileMode(0600))
+//
+// If New fails, it closes the store set by the options, as Close would.
+func New(opts ...Option) (_ *Client, err error) {
+    c := &Client{
+        fileMode:    defaultFileMode,
+        dirMode:     defaultDirMode,
+        now:         time.Now,
+        lockTimeout: defaultLockTimeout,
+        codec:       JSONCodec,
+    }
+    defer func() {
+        if err != nil {
+            c.closeStore()
+        }
+    }()
+    for _, opt := range opts {
+        if err := opt(c); err != nil {
+            return nil, err
+        }
+    }
+    if c.store == nil {
+        if c.dir == "" {
+            dir, err := defaultDir()
+            if err != nil {
+                return nil, err
+            }
+            c.dir = dir
+        }
+        c.store = &FileStore{
+            Dir:      c.dir,
+            FileMode: c.fileMode,
+            DirMode:  c.dirMode,
+        }
+    }
+    if err := c.openNamespace(); err != nil {
+        return nil, err
+    }
+
+    idx, err := c.store.LoadIndex()
     if err != nil {
         if err == IndexFileNotFound {
             idx = nil
@@ -68,14 +220,22 @@ func New() (*Client, error) {
             return nil, err
         }
     }
-
-    c := &Client{
-        Indexer: idx,
+    c.replaceIndexer(idx)
+    if c.janitor != nil {
+        go c.runJanitor()
     }
     return c, nil
 }
 
+// Dir returns the root directory of the cache.
+// It is empty if the Client was created with WithStore.
+func (c *Client) Dir() string {
+    return c.dir
+}
+
 // Get is used to retrieve a cache by specified key.
+// The cache is decoded into output, and the decoded value is returned.
+// See the package function Get for a typed alternative.
 // 
 // Example:
 //   cli, err := honoka.New()
@@ -84,38 +244,69 @@ func New() (*Client, error) {
 //   // OR
 //   result, err := cli.Get("foobar", &output)
 func (c *Client) Get(key string, output interface{}) (interface{}, error) {
-    if c.Expire(key) {
-        return nil, CacheIsExpired
-    }
-    cache, err := c.GetJson(key)
-    if err != nil {
-        return nil, err
-    }
-    var result interface{}
-    err = json.Unmarshal(cache, &result)
-    if err != nil {
-        return nil, err
-    }
-    err = mapstructure.WeakDecode(result, &output);
-    return &output, err
+    return c.GetContext(context.Background(), key, output)
 }
 
 // Get is used to retrieve a cache by specified key.
-// Return value is JSON string
+// Return value is JSON string. Caches stored with another codec are
+// converted to JSON.
 // Example:
 //   cli, err := honoka.New()
 //   result, err := cli.GetJson("foobar")
 func (c *Client) GetJson(key string) ([]byte, error) {
-    if c.Expire(key) {
-        return nil, CacheIsExpired
+    return c.GetJsonContext(context.Background(), key)
+}
+
+// fetch reads the valid cache of key as stored in its bucket.
+func (c *Client) fetch(ctx context.Context, key string) (cached, error) {
+    if c.expire(ctx, key) {
+        return cached{}, CacheIsExpired
     }
 
-    idx := c.Indexer[key]
-    cache, err := getCacheFromBucket(idx.Bucket)
-    if err != nil {
-        return nil, err
+    idx, _ := c.lookup(key)
+    if v, hit := c.memory.get(key, idx.Bucket); hit {
+        c.touch(key)
+        return v, nil
+    }
+    if err := ctx.Err(); err != nil {
+        return cached{}, err
+    }
+    idx, v, err := c.loadCurrent(key, idx)
+    if err == ErrCorrupted && c.corruptionAsMiss {
+        c.deleteIf(ctx, key, func(i Index) bool { return i.Bucket == idx.Bucket })
+        return cached{}, CacheIsExpired
     }
-    return cache, nil
+    if err == nil {
+        c.memory.put(key, idx.Bucket, v)
+        c.touch(key)
+    }
+    return v, err
+}
+
+// loadCurrent reads the bucket of idx. A write may have replaced the entry
+// meanwhile and deleted its bucket, or reused the bucket name for a newer
+// cache, so while the read fails and the index has moved on, it follows
+// the entry. Writes of other processes only show in the store. It returns
+// the entry that was read.
+func (c *Client) loadCurrent(key string, idx Index) (Index, cached, error) {
+    v, err := c.loadCached(idx)
+    for err == BucketFileNotFound || err == ErrCorrupted {
+        current, exists := c.lookup(key)
+        if es := c.entryStore(); es != nil && exists && sameBucket(current, idx) {
+            current, exists, _ = es.LoadEntry(key)
+        }
+        if !exists || sameBucket(current, idx) {
+            break
+        }
+        idx = current
+        v, err = c.loadCached(idx)
+    }
+    return idx, v, err
+}
+
+// sameBucket reports whether a and b refer to the same bucket content.
+func sameBucket(a, b Index) bool {
+    return a.Bucket == b.Bucket && a.Checksum == b.Checksum
 }
 
 // Get is used to create a cache if specified key has not used yet.
@@ -123,39 +314,101 @@ func (c *Client) GetJson(key string) ([]byte, error) {
 // Example:
 //   cli, err := honoka.New()
 //   err := cli.Set("foobar", "fizzbizz", 100)
-func (c *Client) Set(key string, val interface{}, expire int64) error {
-    if ! c.Expire(key) {
-        return nil
+//   // OR
+//   err := cli.Set("foobar", []byte{0xca, 0xfe}, 100, honoka.UseCodec(honoka.RawCodec))
+func (c *Client) Set(key string, val interface{}, expire int64, opts ...CallOption) error {
+    _, err := c.set(context.Background(), key, val, expire, ifInvalid, newCallOptions(opts))
+    return err
+}
+
+// SetNX is Set that reports whether it wrote the cache. It returns false
+// if the key still holds a valid cache.
+//
+// Example:
+//   cli, err := honoka.New()
+//   written, err := cli.SetNX("foobar", "fizzbizz", 100)
+func (c *Client) SetNX(key string, val interface{}, expire int64, opts ...CallOption) (bool, error) {
+    return c.set(context.Background(), key, val, expire, ifInvalid, newCallOptions(opts))
+}
+
+// Put is used to create or replace a cache, whether or not the key holds
+// a valid cache.
+//
+// Example:
+//   cli, err := honoka.New()
+//   err := cli.Put("foobar", "fizzbizz", 100)
+func (c *Client) Put(key string, val interface{}, expire int64, opts ...CallOption) error {
+    _, err := c.set(context.Background(), key, val, expire, always, newCallOptions(opts))
+    return err
+}
+
+// setCond decides whether set may replace the entry of a key. valid
+// reports whether current exists and is not expired. Refusing with an
+// error makes set fail with it.
+type setCond func(current Index, valid bool) (bool, error)
+
+func ifInvalid(current Index, valid bool) (bool, error) {
+    return !valid, nil
+}
+
+func always(current Index, valid bool) (bool, error) {
+    return true, nil
+}
+
+// set writes val as the cache of key if cond allows it and reports whether
+// it wrote.
+func (c *Client) set(ctx context.Context, key string, val interface{}, expire int64, cond setCond, o callOptions) (bool, error) {
+    valid := !c.expire(ctx, key)
+    current, _ := c.lookup(key)
+    if ok, err := cond(current, valid); !ok && err == nil {
+        o.reportVersion(current.Version)
+        return false, nil
     }
 
-    exp := createExpiration(expire)
-    name := getBucketName(key, exp)
-    _, err := createNewBucket(name, val)
+    unlock, err := c.lockIndexContext(ctx)
     if err != nil {
-        return err
+        return false, err
     }
-    var idx IndexList
-    idx, err = getIndexList()
+    defer unlock()
+
+    idx, current, exists, err := c.loadEntry(key)
     if err != nil {
-        if (err == IndexFileNotFound) {
-            idx = map[string]Index{}
-        } else {
-            return err
+        return false, err
+    }
+    // Another process may have set the key since we checked.
+    if ok, err := cond(current, exists && !c.expired(current)); !ok {
+        if idx != nil {
+            c.replaceIndexer(idx)
+        }
+        if err == nil {
+            o.reportVersion(current.Version)
         }
+        return false, err
     }
 
-    idx[key] = Index{
-        Key:        key,
-        Bucket:     name,
-        Expiration: exp,
+    exp := c.createExpiration(expire)
+    entry := c.newIndex(key, c.newBucketName(key, exp, current), exp)
+    if entry.Version, err = c.nextVersion(current); err != nil {
+        return false, err
     }
-    c.setIndexer(idx)
-
-    return nil
+    codec := c.codecFor(o)
+    data, stored, err := c.encodeBucket(&entry, val, codec)
+    if err != nil {
+        return false, err
+    }
+    if err = c.saveEntry(idx, entry, stored); err != nil {
+        return false, err
+    }
+    c.deleteReplaced(current, entry)
+    c.memory.put(key, entry.Bucket, cached{data: data, codec: codec, version: entry.Version})
+    o.reportVersion(entry.Version)
+    return true, nil
 }
 
 // Update calls the cache update function on the cached data.
 // Get is used to retrieve a cache by specified key.
+// Concurrent calls for the same expired key share one UpdateFunc call,
+// unless ForceRefresh is given.
 // 
 // Example:
 //   cli, err := honoka.New()
@@ -164,61 +417,119 @@ func (c *Client) Set(key string, val interface{}, expire int64) error {
 //   cli.Update("foobar", f, 100, &output)
 //   // OR
 //   result, err := cli.Get("foobar", f, 100, &output)
-func (c *Client) Update(key string, updater UpdateFunc, expire int64, output interface{}) (interface{}, error) {
-    b, err := c.UpdateJson(key, updater, expire)
-    if b != nil {
-        var result interface{}
-        e := json.Unmarshal(b, &result)
-        if e != nil {
-            return nil, e
-        }
-
-        e = mapstructure.WeakDecode(result, &output);
-        if e != nil {
-            return nil, e
-        }
-    }
-
-    return output, err
+func (c *Client) Update(key string, updater UpdateFunc, expire int64, output interface{}, opts ...CallOption) (interface{}, error) {
+    return c.UpdateContext(context.Background(), key, updater.withContext(), expire, output, opts...)
 }
 
 // Update calls the cache update function on the cached data.
 // Return value is JSON string.
+// Concurrent calls for the same expired key share one UpdateFunc call,
+// unless ForceRefresh is given.
+// See WithStaleWhileRevalidate and WithStaleIfError for serving stale data.
 // 
 // Example:
 //   cli, err := honoka.New()
 //   f := func() { return "fizzbizz" }
 //   result, err := cli.UpdateJson("foobar", f, 100)
-func (c *Client) UpdateJson(key string, updater UpdateFunc, expire int64) ([]byte, error) {
-    if ! c.Expire(key) {
-        return c.GetJson(key)
+func (c *Client) UpdateJson(key string, updater UpdateFunc, expire int64, opts ...CallOption) ([]byte, error) {
+    return c.UpdateJsonContext(context.Background(), key, updater.withContext(), expire, opts...)
+}
+
+func (c *Client) update(ctx context.Context, key string, updater UpdateContextFunc, expire int64, o callOptions) (cached, error) {
+    if o.forceRefresh {
+        return c.refreshOrFallback(ctx, key, updater, expire, o)
+    }
+    if ! c.expire(ctx, key) {
+        // The bucket may have been deleted concurrently or, with
+        // WithCorruptionAsMiss, found corrupted. Both are refreshed.
+        if v, err := c.fetch(ctx, key); !isMiss(err) {
+            return v, err
+        }
+    }
+    if idx, exists := c.lookup(key); exists && c.inGrace(idx) {
+        if stale, err := c.loadCached(idx); err == nil {
+            c.revalidate(ctx, key, updater, expire, o)
+            return stale, nil
+        }
     }
 
-    val, err := updater()
-    if err != nil {
-        return nil, err
+    return c.flights.do(ctx, key, func() (cached, error) {
+        // A refresh may have finished between the check above and here.
+        if ! c.expire(ctx, key) {
+            if v, err := c.fetch(ctx, key); !isMiss(err) {
+                return v, err
+            }
+        }
+        return c.refreshOrFallback(ctx, key, updater, expire, o)
+    })
+}
+
+func isMiss(err error) bool {
+    return err == CacheIsExpired || err == BucketFileNotFound
+}
+
+// refreshOrFallback refreshes key and, if that fails, falls back to the
+// retained stale bucket when stale-if-error is enabled. A refresh that
+// failed because ctx is done gets no fallback.
+func (c *Client) refreshOrFallback(ctx context.Context, key string, updater UpdateContextFunc, expire int64, o callOptions) (cached, error) {
+    v, err := c.refresh(ctx, key, updater, expire, o)
+    if err == nil || ctx.Err() != nil {
+        return v, err
+    }
+    idx, exists := c.lookup(key)
+    if !exists || c.now().Unix() >= idx.StaleIfError {
+        return cached{}, err
+    }
+    stale, e := c.loadCached(idx)
+    if e != nil {
+        return cached{}, err
     }
+    return stale, &StaleError{Err: err}
+}
 
-    exp := createExpiration(expire)
-    name := getBucketName(key, exp)
-    jval, err := createNewBucket(name, val)
+// refresh calls updater and stores its result as the new cache of key.
+// Once ctx is done nothing is written; after the lock is taken the bucket
+// and index are written to completion.
+func (c *Client) refresh(ctx context.Context, key string, updater UpdateContextFunc, expire int64, o callOptions) (cached, error) {
+    val, err := updater(ctx)
     if err != nil {
-        return jval, err
+        return cached{}, err
     }
-    var idx IndexList
-    idx, err = getIndexList()
+    if err = ctx.Err(); err != nil {
+        return cached{}, err
+    }
+
+    unlock, err := c.lockIndexContext(ctx)
     if err != nil {
-        idx = c.Indexer
+        return cached{}, err
+    }
+    defer unlock()
+    if err = ctx.Err(); err != nil {
+        return cached{}, err
     }
 
-    idx[key] = Index{
-        Key:        key,
-        Bucket:     name,
-        Expiration: exp,
+    idx, previous, _, err := c.loadEntry(key)
+    if err != nil {
+        return cached{}, err
+    }
+    exp := c.createExpiration(expire)
+    entry := c.newIndex(key, c.newBucketName(key, exp, previous), exp)
+    if entry.Version, err = c.nextVersion(previous); err != nil {
+        return cached{}, err
+    }
+    codec := c.codecFor(o)
+    data, stored, err := c.encodeBucket(&entry, val, codec)
+    if err != nil {
+        return cached{}, err
+    }
+    if err = c.saveEntry(idx, entry, stored); err != nil {
+        return cached{}, err
     }
-    c.setIndexer(idx)
+    c.deleteReplaced(previous, entry)
 
-    return jval, nil
+    v := cached{data: data, codec: codec, version: entry.Version}
+    c.memory.put(key, entry.Bucket, v)
+    return v, nil
 }
 
 // Delete is used to delete a cache by specified key.
@@ -227,21 +538,17 @@ func (c *Client) UpdateJson(key string, updater UpdateFunc, expire int64) ([]byt
 //   cli, err := honoka.New()
 //   err = cli.Delete("foobar")
 func (c *Client) Delete(key string) error {
-    idx := c.Indexer[key]
-    path, err := getBucketPath(idx.Bucket)
-    if err != nil {
-        return err
-    }
-    if fileExists(path) {
-        err = os.Remove(path)
-        if err != nil {
-            return err
-        }
-    }
+    return c.DeleteContext(context.Background(), key)
+}
 
-    delete(c.Indexer, key)
-    c.setIndexer(c.Indexer)
-    return nil
+// deleteIf deletes key under the index lock if cond reports true for the
+// entry currently on disk. A nil cond always deletes.
+func (c *Client) deleteIf(ctx context.Context, key string, cond func(Index) bool) error {
+    _, err := c.deleteIfMulti(ctx, map[string]func(Index) bool{key: cond})
+    if errs, ok := err.(MultiError); ok {
+        return errs[key]
+    }
+    return err
 }
 
 // Expire is a predicate which determines if the cache should be updated.
@@ -250,14 +557,16 @@ func (c *Client) Delete(key string) error {
 //   cli, err := honoka.New()
 //   expired := cli.Expire("foobar")
 func (c *Client) Expire(key string) bool {
-    if nil == c.Indexer {
-        return true
-    }
+    return c.expire(context.Background(), key)
+}
 
-    idx, exists := c.Indexer[key]
+func (c *Client) expire(ctx context.Context, key string) bool {
+    idx, exists := c.lookup(key)
     if exists {
-        if idx.Expiration <= time.Now().Unix() {
-            c.Delete(key)
+        if c.expired(idx) {
+            if c.removable(idx) {
+                c.deleteIf(ctx, key, c.removable)
+            }
             return true
         } else {
             return false
@@ -266,6 +575,37 @@ func (c *Client) Expire(key string) bool {
     return true
 }
 
+func (c *Client) expired(idx Index) bool {
+    return idx.Expiration <= c.now().Unix()
+}
+
+// inGrace reports whether idx is expired but may still be served while it
+// is refreshed.
+func (c *Client) inGrace(idx Index) bool {
+    return c.expired(idx) && c.now().Unix() < idx.Grace
+}
+
+// removable reports whether idx is expired and no longer retained for
+// stale serving, so that its entry and bucket can be deleted.
+func (c *Client) removable(idx Index) bool {
+    return c.expired(idx) && !c.inGrace(idx) && c.now().Unix() >= idx.StaleIfError
+}
+
+func (c *Client) newIndex(key, bucket string, expiration int64) Index {
+    idx := Index{
+        Key:        key,
+        Bucket:     bucket,
+        Expiration: expiration,
+    }
+    if c.grace > 0 {
+        idx.Grace = expiration + c.grace
+    }
+    if c.staleIfError > 0 {
+        idx.StaleIfError = expiration + c.staleIfError
+    }
+    return idx
+}
+
 // Outdated is used to retrive no-indexed bucket.
 // 
 // Example:
@@ -282,7 +622,7 @@ func (c *Client) Outdated() ([]string, error) {
     }
 
     var list []string
-    buckets, err := getBucketList()
+    buckets, err := c.store.ListBuckets()
     if err != nil {
         return nil, err
     }
@@ -299,25 +639,33 @@ func (c *Client) Outdated() ([]string, error) {
 //   cli, err := honoka.New()
 //   result, err := cli.Clean()
 func (c *Client) Clean() ([]CleanResult, error) {
-    bucketsDir, err := getBucketsDirPath()
+    // Hold the index lock so that a bucket written by a concurrent Set is
+    // not mistaken for an orphan before its index entry lands.
+    unlock, err := c.lockIndex()
     if err != nil {
         return nil, err
     }
+    defer unlock()
+
     list, err := c.Outdated()
     if err != nil {
         return nil, err
     }
+    return c.deleteBuckets(list), nil
+}
 
+// deleteBuckets deletes the listed buckets and reports the result of each.
+func (c *Client) deleteBuckets(list []string) []CleanResult {
     var result []CleanResult
     for _, bucket := range list {
-        e := os.Remove(filepath.Join(bucketsDir, bucket))
+        e := c.store.DeleteBucket(bucket)
         r := CleanResult{
             Bucket: bucket,
             Error:  e,
         }
         result = append(result, r)
     }
-    return result, nil
+    return result
 }
 
 // List is used to retrive cache indexes.
@@ -338,141 +686,239 @@ func (c *Client) List() ([]Index, error) {
     return list, nil  
 }
 
-func (c *Client) getIndexer(replace bool) (IndexList, error) {
-    if replace || c.Indexer == nil {
-        idx, err := getIndexList()
+// weakDecode decodes JSON into output with mapstructure and returns the
+// decoded value. If output is not a pointer the value is only returned.
+func weakDecode(b []byte, output interface{}) (interface{}, error) {
+    var result interface{}
+    err := json.Unmarshal(b, &result)
+    if err != nil {
+        return nil, err
+    }
+    return weakDecodeValue(result, output)
+}
+
+// untypedValue is the type under which the memory tier keeps the values
+// of the untyped methods, decoded from JSON into interface{}.
+type untypedValue struct{}
+
+// fetchValue is fetch followed by decoding the JSON form of the payload
+// into interface{}, with the version.
+func (c *Client) fetchValue(ctx context.Context, key string) (interface{}, uint64, error) {
+    return c.fetchDecoded(ctx, key, reflect.TypeOf(untypedValue{}), func(cache cached) (interface{}, error) {
+        b, err := cache.json()
         if err != nil {
             return nil, err
         }
-        c.Indexer = idx
-    }
-    return c.Indexer, nil
+        var result interface{}
+        err = json.Unmarshal(b, &result)
+        return result, err
+    })
 }
 
-func (c *Client) setIndexer(indexes IndexList) error {
-    idx, err := json.Marshal(indexes)
-    if err != nil {
-        return err
+// weakDecodeValue is weakDecode for a value decoded from JSON.
+func weakDecodeValue(result, output interface{}) (interface{}, error) {
+    var err error
+    rv := reflect.ValueOf(output)
+    if rv.Kind() != reflect.Ptr || rv.IsNil() {
+        err = mapstructure.WeakDecode(result, &output)
+        return output, err
     }
+    err = mapstructure.WeakDecode(result, output)
+    return rv.Elem().Interface(), err
+}
 
-    if err = updateIndexFile(idx); err != nil {
-        return err
+func (c *Client) getIndexer(replace bool) (IndexList, error) {
+    c.mu.RLock()
+    var idx IndexList
+    if c.Indexer != nil {
+        idx = copyIndexList(c.Indexer)
     }
-    c.Indexer = indexes
-    return nil
+    c.mu.RUnlock()
+    if replace || idx == nil {
+        var err error
+        idx, err = c.store.LoadIndex()
+        if err != nil {
+            return nil, err
+        }
+        c.replaceIndexer(copyIndexList(idx))
+    }
+    return idx, nil
 }
 
-func getBucketsDirPath() (string, error) {
-    home, err := homedir.Dir()
-    if err != nil {
-        return "", err
-    }
-    bucketsDir := filepath.Join(home, ".honoka", "buckets")
-    os.MkdirAll(bucketsDir, 0700)
-    return bucketsDir, err
+// lookup returns the in-memory index entry for key.
+func (c *Client) lookup(key string) (Index, bool) {
+    c.mu.RLock()
+    defer c.mu.RUnlock()
+    idx, exists := c.Indexer[key]
+    return idx, exists
 }
 
-func getBucketPath(bucketName string) (string, error) {
-    bucketsDir, err := getBucketsDirPath()
-    if err != nil {
-        return "", err
-    }
-    return filepath.Join(bucketsDir, bucketName), nil
+// replaceIndexer publishes a new index list. A published list is modified
+// in place only while holding both the index lock and c.mu, so it may be
+// read under either of them.
+func (c *Client) replaceIndexer(indexes IndexList) {
+    c.mu.Lock()
+    c.Indexer = indexes
+    c.mu.Unlock()
 }
 
-func getCacheFromBucket(bucketName string) ([]byte, error) {
-    path, err := getBucketPath(bucketName)
+// loadIndexer reads the index file for a read-modify-write.
+// A missing index file yields an empty list.
+// The caller must hold the index lock.
+func (c *Client) loadIndexer() (IndexList, error) {
+    idx, err := c.store.LoadIndex()
+    if err == IndexFileNotFound {
+        return IndexList{}, nil
+    }
     if err != nil {
         return nil, err
     }
-    if !fileExists(path) {
-        return nil, BucketFileNotFound
+    if idx == nil {
+        idx = IndexList{}
     }
-    return ioutil.ReadFile(path);
+    return idx, nil
 }
 
-func getBucketList() ([]string, error) {
-    bucketsDir, err := getBucketsDirPath()
+// loadEntry reads the saved index entry of key for a write of that key
+// alone. It also returns the whole index, unless the store can save the
+// entry by itself, in which case idx is nil.
+// The caller must hold the index lock.
+func (c *Client) loadEntry(key string) (idx IndexList, current Index, exists bool, err error) {
+    if es := c.entryWriter(); es != nil {
+        current, exists, err = es.LoadEntry(key)
+        return nil, current, exists, err
+    }
+    idx, err = c.loadIndexer()
     if err != nil {
-        return nil, err
+        return nil, Index{}, false, err
     }
-    files, err := ioutil.ReadDir(bucketsDir)
-    var list []string
-    for _, fi := range files {
-        if !fi.IsDir() {
-            filename := fi.Name()
-            list = append(list, filename)
+    current, exists = idx[key]
+    return idx, current, exists, nil
+}
+
+// saveEntry writes stored as the bucket of entry and saves entry in the
+// index, given idx as returned by loadEntry.
+// The caller must hold the index lock.
+func (c *Client) saveEntry(idx IndexList, entry Index, stored []byte) error {
+    if idx == nil {
+        if err := c.entryWriter().PutEntry(entry, stored); err != nil {
+            return err
         }
+        c.mu.Lock()
+        if c.Indexer == nil {
+            c.Indexer = IndexList{}
+        }
+        c.Indexer[entry.Key] = entry
+        c.mu.Unlock()
+        return nil
     }
-    return list, nil
-}
 
-func createNewBucket(name string, val interface{}) ([]byte, error) {
-    jval, err := json.Marshal(val)
-    if err != nil {
-        return nil, err
+    if err := c.store.WriteBucket(entry.Bucket, stored); err != nil {
+        return err
     }
-    path, err := getBucketPath(name)
-    if err != nil {
-        return jval, err
+    idx[entry.Key] = entry
+    if err := c.evict(idx, entry.Key); err != nil {
+        return err
     }
-    err = ioutil.WriteFile(path, jval, 0644)
-    return jval, err
+    return c.setIndexer(idx)
 }
 
-func getBucketName(key string, expiration int64) string {
-    k := key + "." + strconv.FormatInt(expiration, 10)
-    bytes := sha256.Sum256([]byte(k))
-    return hex.EncodeToString(bytes[:])
+// entryStore returns the store as an EntryStore, or nil if it is not one.
+func (c *Client) entryStore() EntryStore {
+    es, _ := c.store.(EntryStore)
+    return es
 }
 
-func getIndexPath() (string, error) {
-    home, err := homedir.Dir()
-    if err != nil {
-        return "", err
+// entryWriter is entryStore for writes, which also need the whole index
+// if the Client has size limits, for eviction.
+func (c *Client) entryWriter() EntryStore {
+    if c.bounded() {
+        return nil
     }
-    indexDir := filepath.Join(home, ".honoka")
-    os.MkdirAll(indexDir, 0700)
-    return filepath.Join(indexDir, "index"), err
+    return c.entryStore()
 }
 
-func getIndexList() (IndexList, error) {
-    b, err := getIndexFromFile()
+func (c *Client) setIndexer(indexes IndexList) error {
+    c.applyAccesses(indexes)
+    if err := c.store.SaveIndex(indexes); err != nil {
+        return err
+    }
+    c.replaceIndexer(indexes)
+    return nil
+}
+
+// getCacheFromBucket reads the bucket of idx and undoes its compression.
+func (c *Client) getCacheFromBucket(idx Index) ([]byte, error) {
+    data, err := c.store.ReadBucket(idx.Bucket)
     if err != nil {
         return nil, err
     }
-    var list IndexList
-    err = json.Unmarshal(b, &list)
-    if  err != nil {
-        return nil, err
+    if idx.Checksum != "" && checksum(data) != idx.Checksum {
+        return nil, ErrCorrupted
     }
-    return list, nil
+    return decompress(idx.Compression, data)
 }
 
-func getIndexFromFile() ([]byte, error) {
-    path, err := getIndexPath()
+// createNewBucket encodes val with codec, compresses it if configured and
+// writes it to the bucket of idx. The storage details are recorded in idx.
+// It returns the encoded, uncompressed payload.
+func (c *Client) createNewBucket(idx *Index, val interface{}, codec Codec) ([]byte, error) {
+    data, stored, err := c.encodeBucket(idx, val, codec)
     if err != nil {
         return nil, err
     }
-    if !fileExists(path) {
-        return nil, IndexFileNotFound
-    }
-    return ioutil.ReadFile(path);
+    err = c.store.WriteBucket(idx.Bucket, stored)
+    return data, err
 }
 
-func updateIndexFile(indexes []byte) error {
-    path, err := getIndexPath()
+// encodeBucket is createNewBucket without the write. It returns the
+// encoded data and the bucket content.
+func (c *Client) encodeBucket(idx *Index, val interface{}, codec Codec) ([]byte, []byte, error) {
+    data, err := codec.Marshal(val)
     if err != nil {
-        return err
+        return nil, nil, err
     }
-    return ioutil.WriteFile(path, indexes, 0644);
+    idx.Codec = codec.Name()
+    stored, err := c.compress(idx, data)
+    if err != nil {
+        return nil, nil, err
+    }
+    idx.Checksum = checksum(stored)
+    idx.Size = int64(len(stored))
+    idx.Accessed = c.now().UnixNano()
+    return data, stored, nil
+}
+
+// deleteReplaced deletes the bucket of previous once the saved index
+// refers to entry instead. A bucket that cannot be deleted is left to Clean.
+func (c *Client) deleteReplaced(previous, entry Index) {
+    if previous.Bucket != "" && previous.Bucket != entry.Bucket {
+        c.store.DeleteBucket(previous.Bucket)
+    }
+}
+
+func checksum(data []byte) string {
+    sum := sha256.Sum256(data)
+    return hex.EncodeToString(sum[:])
 }
 
-func fileExists(filename string) bool {
-    _, err := os.Stat(filename)
-    return err == nil
+func getBucketName(key string, expiration int64) string {
+    k := key + "." + strconv.FormatInt(expiration, 10)
+    bytes := sha256.Sum256([]byte(k))
+    return hex.EncodeToString(bytes[:])
+}
+
+// newBucketName returns the bucket name for a new cache of key. It differs
+// from the bucket of the current entry, which may still be read while the
+// new one is written.
+func (c *Client) newBucketName(key string, expiration int64, current Index) string {
+    name := getBucketName(key, expiration)
+    for n := 1; name == current.Bucket; n++ {
+        name = getBucketName(key + "." + strconv.Itoa(n), expiration)
+    }
+    return name
 }
 
-func createExpiration(expire int64) int64 {
-    return time.Now().Unix() + expire
+func (c *Client) createExpiration(expire int64) int64 {
+    return c.now().Unix() + expire
 }
@@ -1,55 +1,109 @@
 package honoka
 
 import (
+  "io/ioutil"
+  "os"
   "testing"
   "path/filepath"
   "time"
   "strconv"
-  homedir "github.com/mitchellh/go-homedir"
   // for Debug
   // "github.com/davecgh/go-spew/spew"
 )
 
+func TestMain(m *testing.M) {
+    dir, err := ioutil.TempDir("", "honoka-test")
+    if err != nil {
+        panic(err)
+    }
+    os.Setenv(EnvDir, dir)
+    code := m.Run()
+    os.RemoveAll(dir)
+    os.Exit(code)
+}
+
+func newTestClient(t *testing.T, opts ...Option) *Client {
+    opts = append([]Option{WithDir(t.TempDir())}, opts...)
+    cli, err := New(opts...)
+    if err != nil {
+        t.Fatalf("occurred error when get cache client: %#v", err)
+    }
+    return cli
+}
+
+func fileStore(cli *Client) *FileStore {
+    return cli.store.(*FileStore)
+}
+
 func TestGetIndexPath(t *testing.T) {
-    actual, err := getIndexPath()
+    cli := newTestClient(t)
+    actual, err := fileStore(cli).getIndexPath()
     if err != nil {
         t.Errorf("occurred error when get index path: %v", err)
     }
 
-    home, _ := homedir.Dir()
-    expected := filepath.Join(home, ".honoka", "index")
+    expected := filepath.Join(cli.Dir(), "index")
     if actual != expected {
         t.Errorf("actual does not match expected. actual: %s , expected: %s", actual, expected)
     }
 }
 
 func TestGetBucketsDirPath(t *testing.T) {
-    actual, err := getBucketsDirPath()
+    cli := newTestClient(t)
+    actual, err := fileStore(cli).getBucketsDirPath()
     if err != nil {
         t.Errorf("occurred error when get bucket directory path: %v", err)
     }
 
-    home, _ := homedir.Dir()
-    expected := filepath.Join(home, ".honoka", "buckets")
+    expected := filepath.Join(cli.Dir(), "buckets")
     if actual != expected {
         t.Errorf("actual does not match expected. actual: %s , expected: %s", actual, expected)
     }
 }
 
 func TestGetBucketPath(t *testing.T) {
+    cli := newTestClient(t)
     dummyBucket := "foobar"
-    actual, err := getBucketPath(dummyBucket)
+    actual, err := fileStore(cli).getBucketPath(dummyBucket)
     if err != nil {
         t.Errorf("occurred error when get bucket directory path: %v", err)
     }
 
-    home, _ := homedir.Dir()
-    expected := filepath.Join(home, ".honoka", "buckets", dummyBucket)
+    expected := filepath.Join(cli.Dir(), "buckets", "fo", "ob", dummyBucket)
     if actual != expected {
         t.Errorf("actual does not match expected. actual: %s , expected: %s", actual, expected)
     }
 }
 
+func TestDefaultDirFromEnv(t *testing.T) {
+    cli, err := New()
+    if err != nil {
+        t.Fatalf("occurred error when get cache client: %#v", err)
+    }
+    expected := os.Getenv(EnvDir)
+    if cli.Dir() != expected {
+        t.Errorf("actual does not match expected. actual: %s , expected: %s", cli.Dir(), expected)
+    }
+}
+
+func TestClock(t *testing.T) {
+    now := time.Unix(1000, 0)
+    cli := newTestClient(t, WithClock(func() time.Time { return now }))
+
+    err := cli.Set("testClock", "foobar", 10)
+    if err != nil {
+        t.Errorf("occurred error when set cache (string): %#v", err)
+    }
+    if cli.Expire("testClock") {
+        t.Errorf("cache is expired before its expiration")
+    }
+
+    now = now.Add(10 * time.Second)
+    if !cli.Expire("testClock") {
+        t.Errorf("cache is not expired after its expiration")
+    }
+}
+
 func TestNew(t *testing.T) {
     _, err := New()
     if err != nil {
@@ -79,6 +133,46 @@ func TestSaveCache(t *testing.T) {
     }
 }
 
+func TestPut(t *testing.T) {
+    cli := newTestClient(t)
+    var previous string
+    for _, val := range []string{"foo", "bar", "fizz"} {
+        if err := cli.Put("testPut", val, 100); err != nil {
+            t.Fatalf("occurred error when put cache: %v", err)
+        }
+        actual, err := Get[string](cli, "testPut")
+        if err != nil || actual != val {
+            t.Errorf("actual does not match expected. actual: %s (%v) , expected: %s", actual, err, val)
+        }
+        // The bucket being replaced is never overwritten in place.
+        idx, _ := cli.lookup("testPut")
+        if idx.Bucket == previous {
+            t.Errorf("bucket is reused: %s", idx.Bucket)
+        }
+        previous = idx.Bucket
+    }
+    outdated, err := cli.Outdated()
+    if err != nil || len(outdated) != 0 {
+        t.Errorf("replaced buckets are left behind: %v (%v)", outdated, err)
+    }
+}
+
+func TestSetNX(t *testing.T) {
+    cli := newTestClient(t)
+    written, err := cli.SetNX("testSetNX", "foo", 100)
+    if err != nil || !written {
+        t.Errorf("actual does not match expected. actual: %v (%v) , expected: %v", written, err, true)
+    }
+    written, err = cli.SetNX("testSetNX", "bar", 100)
+    if err != nil || written {
+        t.Errorf("actual does not match expected. actual: %v (%v) , expected: %v", written, err, false)
+    }
+    actual, _ := Get[string](cli, "testSetNX")
+    if actual != "foo" {
+        t.Errorf("actual does not match expected. actual: %s , expected: %s", actual, "foo")
+    }
+}
+
 func TestExpire(t *testing.T) {
     cli, err := New()
     if err != nil {
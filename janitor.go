@@ -0,0 +1,144 @@
+package honoka
+
+import (
+    "errors"
+    "io"
+    "sync"
+    "time"
+)
+
+// JanitorResult reports one pass of the background janitor.
+type JanitorResult struct {
+    // Expired index entries removed together with their buckets.
+    Expired []Index
+
+    // No-indexed buckets deleted, as returned by Clean.
+    Cleaned []CleanResult
+
+    // The error that stopped the pass, if any.
+    Error   error
+}
+
+type janitor struct {
+    interval time.Duration
+    report   func(JanitorResult)
+    stop     chan struct{}
+    done     chan struct{}
+    once     sync.Once
+}
+
+// WithJanitor starts a background goroutine that, every interval, removes
+// expired index entries with their buckets and then deletes no-indexed
+// buckets like Clean. report, if not nil, receives the result of each pass.
+// Call Close to stop it.
+//
+// Example:
+//   cli, err := honoka.New(honoka.WithJanitor(10 * time.Minute, nil))
+//   defer cli.Close()
+func WithJanitor(interval time.Duration, report func(JanitorResult)) Option {
+    return func(c *Client) error {
+        if interval <= 0 {
+            return errors.New("honoka: janitor interval must be positive")
+        }
+        c.janitor = &janitor{
+            interval: interval,
+            report:   report,
+            stop:     make(chan struct{}),
+            done:     make(chan struct{}),
+        }
+        return nil
+    }
+}
+
+// Close stops the background janitor, waits for background refreshes and
+// closes the Store if it is an io.Closer. The Client must not be used
+// afterwards.
+func (c *Client) Close() error {
+    if j := c.janitor; j != nil {
+        j.once.Do(func() {
+            close(j.stop)
+        })
+        <-j.done
+    }
+    c.Wait()
+    return c.closeStore()
+}
+
+// closeStore closes the store if it is an io.Closer. Before the namespace
+// is opened, the root is still the store itself.
+func (c *Client) closeStore() error {
+    root := c.root
+    if root == nil {
+        root = c.store
+    }
+    if closer, ok := root.(io.Closer); ok {
+        return closer.Close()
+    }
+    return nil
+}
+
+func (c *Client) runJanitor() {
+    j := c.janitor
+    defer close(j.done)
+    ticker := time.NewTicker(j.interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-j.stop:
+            return
+        case <-ticker.C:
+            result := c.sweep()
+            if j.report != nil {
+                j.report(result)
+            }
+        }
+    }
+}
+
+// sweep is one janitor pass.
+func (c *Client) sweep() JanitorResult {
+    var result JanitorResult
+    result.Expired, result.Error = c.Purge()
+    if result.Error != nil {
+        return result
+    }
+    result.Cleaned, result.Error = c.Clean()
+    if result.Error == IndexFileNotFound {
+        result.Error = nil
+    }
+    return result
+}
+
+// Purge removes every index entry that is expired and no longer retained
+// for stale serving, together with its bucket, and returns the removed
+// entries.
+//
+// Example:
+//   cli, err := honoka.New()
+//   removed, err := cli.Purge()
+func (c *Client) Purge() ([]Index, error) {
+    unlock, err := c.lockIndex()
+    if err != nil {
+        return nil, err
+    }
+    defer unlock()
+
+    idx, err := c.loadIndexer()
+    if err != nil {
+        return nil, err
+    }
+    conds := make(map[string]func(Index) bool)
+    entries := make(map[string]Index)
+    for key, entry := range idx {
+        if c.removable(entry) {
+            conds[key] = c.removable
+            entries[key] = entry
+        }
+    }
+    deleted, err := c.removeEntries(idx, conds)
+    var removed []Index
+    for _, key := range deleted {
+        removed = append(removed, entries[key])
+    }
+    return removed, err
+}
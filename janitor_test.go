@@ -0,0 +1,59 @@
+package honoka
+
+import (
+    "io/ioutil"
+    "path/filepath"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestJanitor(t *testing.T) {
+    var mu sync.Mutex
+    now := time.Unix(1000, 0)
+    clock := func() time.Time {
+        mu.Lock()
+        defer mu.Unlock()
+        return now
+    }
+    results := make(chan JanitorResult, 10)
+    cli := newTestClient(t, WithClock(clock), WithJanitor(10 * time.Millisecond, func(r JanitorResult) {
+        results <- r
+    }))
+    defer cli.Close()
+
+    if err := cli.Set("testJanitor", "foobar", 10); err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+    dir, _ := fileStore(cli).getBucketsDirPath()
+    ioutil.WriteFile(filepath.Join(dir, "orphan"), []byte("{}"), 0644)
+
+    mu.Lock()
+    now = now.Add(time.Minute)
+    mu.Unlock()
+
+    var expired, cleaned int
+    deadline := time.After(5 * time.Second)
+    for expired == 0 || cleaned == 0 {
+        select {
+        case r := <-results:
+            if r.Error != nil {
+                t.Fatalf("occurred error in janitor: %v", r.Error)
+            }
+            expired += len(r.Expired)
+            cleaned += len(r.Cleaned)
+        case <-deadline:
+            t.Fatalf("janitor did not purge. expired: %d , cleaned: %d", expired, cleaned)
+        }
+    }
+    if _, exists := cli.lookup("testJanitor"); exists {
+        t.Errorf("expired entry is left in index")
+    }
+}
+
+func TestCloseWithoutJanitor(t *testing.T) {
+    cli := newTestClient(t)
+    if err := cli.Close(); err != nil {
+        t.Errorf("occurred error when close client: %v", err)
+    }
+}
@@ -0,0 +1,396 @@
+package honoka
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/json"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const defaultMaxJournal = 1000
+
+// journalRecord is one line of the index journal: the changes of a single
+// SaveIndex. A line is applied completely or, if it was torn by a crash,
+// not at all.
+type journalRecord struct {
+    Set    []Index  `json:"set,omitempty"`
+    Delete []string `json:"del,omitempty"`
+}
+
+// fileState identifies the index files a cached index was read from.
+type fileState struct {
+    snapshotSize int64
+    snapshotMod  time.Time
+    journalSize  int64
+}
+
+// getVersionPath returns the file that keeps the highest version across
+// compactions, which drop deleted entries.
+func (s *FileStore) getVersionPath() string {
+    return filepath.Join(s.Dir, "index.version")
+}
+
+func (s *FileStore) getJournalPath() string {
+    return filepath.Join(s.Dir, "index.journal")
+}
+
+func (s *FileStore) maxJournal() int {
+    if s.MaxJournal > 0 {
+        return s.MaxJournal
+    }
+    return defaultMaxJournal
+}
+
+func (s *FileStore) stat() (fileState, bool) {
+    var st fileState
+    found := false
+    if fi, err := os.Stat(filepath.Join(s.Dir, "index")); err == nil {
+        st.snapshotSize = fi.Size()
+        st.snapshotMod = fi.ModTime()
+        found = true
+    }
+    if fi, err := os.Stat(s.getJournalPath()); err == nil {
+        st.journalSize = fi.Size()
+        found = true
+    }
+    return st, found
+}
+
+// loadIndex returns a copy of the replayed index.
+// The caller must hold s.mu.
+func (s *FileStore) loadIndex() (IndexList, error) {
+    if err := s.replay(); err != nil {
+        return nil, err
+    }
+    return copyIndexList(s.state), nil
+}
+
+// replay reads the snapshot and replays the journal on top of it into
+// s.state, unless the files are unchanged since the last time.
+// A torn record at the end of the journal is ignored.
+// The caller must hold s.mu.
+func (s *FileStore) replay() error {
+    st, found := s.stat()
+    if !found {
+        s.state = nil
+        return IndexFileNotFound
+    }
+    if s.state != nil && st == s.files {
+        return nil
+    }
+
+    idx := IndexList{}
+    b, err := s.getIndexFromFile()
+    if err == nil {
+        if err = json.Unmarshal(b, &idx); err != nil {
+            return err
+        }
+        if idx == nil {
+            idx = IndexList{}
+        }
+    } else if err != IndexFileNotFound {
+        return err
+    }
+    version, err := s.readVersion()
+    if err != nil {
+        return err
+    }
+    version = highestVersion(version, idx)
+
+    journal, err := ioutil.ReadFile(s.getJournalPath())
+    if err != nil && !os.IsNotExist(err) {
+        return err
+    }
+    var valid int64
+    records := 0
+    r := bufio.NewReader(bytes.NewReader(journal))
+    for {
+        line, err := r.ReadBytes('\n')
+        if err != nil {
+            // The last line has no newline, so its append did not finish.
+            break
+        }
+        var rec journalRecord
+        if json.Unmarshal(line, &rec) != nil {
+            break
+        }
+        version = rec.highestVersion(idx, version)
+        rec.apply(idx)
+        valid += int64(len(line))
+        records++
+    }
+
+    s.state = idx
+    s.maxVersion = version
+    s.files = st
+    s.files.journalSize = int64(len(journal))
+    s.journalValid = valid
+    s.journalRecords = records
+    return nil
+}
+
+// saveIndex appends the difference between the current index and idx to
+// the journal. The caller must hold s.mu.
+func (s *FileStore) saveIndex(idx IndexList) error {
+    if err := s.replay(); err != nil && err != IndexFileNotFound {
+        return err
+    }
+    if s.state == nil {
+        return s.compact(idx)
+    }
+
+    rec := diffIndex(s.state, idx)
+    if len(rec.Set) == 0 && len(rec.Delete) == 0 {
+        return nil
+    }
+    return s.commit(rec)
+}
+
+// writeRecord applies rec to the saved index. The caller must hold s.mu.
+func (s *FileStore) writeRecord(rec journalRecord) error {
+    if err := s.replay(); err != nil && err != IndexFileNotFound {
+        return err
+    }
+    if s.state == nil {
+        idx := IndexList{}
+        rec.apply(idx)
+        return s.compact(idx)
+    }
+    return s.commit(rec)
+}
+
+// commit appends rec to the journal, and compacts everything into a new
+// snapshot once the journal reaches MaxJournal records.
+// The caller must hold s.mu and have replayed the index.
+func (s *FileStore) commit(rec journalRecord) error {
+    if err := s.appendRecord(rec); err != nil {
+        return err
+    }
+    if s.journalRecords >= s.maxJournal() {
+        return s.compact(s.state)
+    }
+    return nil
+}
+
+// LoadEntry returns the entry of key from the replayed index, without
+// copying the rest.
+func (s *FileStore) LoadEntry(key string) (Index, bool, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if err := s.replay(); err != nil {
+        if err == IndexFileNotFound {
+            return Index{}, false, nil
+        }
+        return Index{}, false, err
+    }
+    entry, exists := s.state[key]
+    return entry, exists, nil
+}
+
+// PutEntry writes the bucket of entry, then appends entry alone to the
+// journal. A crash in between only leaves an orphaned bucket for Clean.
+func (s *FileStore) PutEntry(entry Index, data []byte) error {
+    if err := s.WriteBucket(entry.Bucket, data); err != nil {
+        return err
+    }
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.writeRecord(journalRecord{Set: []Index{entry}})
+}
+
+// DeleteEntry is DeleteEntries for a single key.
+func (s *FileStore) DeleteEntry(key string) error {
+    return s.DeleteEntries([]string{key})
+}
+
+// DeleteEntries appends the deletion of keys to the journal as one record,
+// then deletes their buckets. A crash in between only leaves orphaned
+// buckets for Clean.
+func (s *FileStore) DeleteEntries(keys []string) error {
+    s.mu.Lock()
+    var entries []Index
+    err := s.replay()
+    if err == nil {
+        var rec journalRecord
+        for _, key := range keys {
+            if entry, exists := s.state[key]; exists {
+                entries = append(entries, entry)
+                rec.Delete = append(rec.Delete, key)
+            }
+        }
+        if len(rec.Delete) > 0 {
+            err = s.writeRecord(rec)
+        }
+    }
+    s.mu.Unlock()
+    if err != nil && err != IndexFileNotFound {
+        return err
+    }
+    for _, entry := range entries {
+        s.DeleteBucket(entry.Bucket)
+    }
+    return nil
+}
+
+// appendRecord writes rec to the end of the journal and applies it to the
+// replayed index. The caller must hold s.mu and have loaded the index.
+func (s *FileStore) appendRecord(rec journalRecord) error {
+    line, err := json.Marshal(rec)
+    if err != nil {
+        return err
+    }
+    line = append(line, '\n')
+
+    path := s.getJournalPath()
+    f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, s.FileMode)
+    if err != nil {
+        return err
+    }
+    // Drop a torn record left by a crash, so the new one starts on its own line.
+    if err = f.Truncate(s.journalValid); err == nil {
+        _, err = f.WriteAt(line, s.journalValid)
+    }
+    if err == nil {
+        err = f.Sync()
+    }
+    if e := f.Close(); err == nil {
+        err = e
+    }
+    if err != nil {
+        s.state = nil
+        return err
+    }
+    if s.journalValid == 0 {
+        if err = syncDir(s.Dir); err != nil {
+            return err
+        }
+    }
+
+    s.maxVersion = rec.highestVersion(s.state, s.maxVersion)
+    rec.apply(s.state)
+    s.journalValid += int64(len(line))
+    s.journalRecords++
+    s.files, _ = s.stat()
+    return nil
+}
+
+// compact writes idx as the snapshot and empties the journal. idx must be
+// the snapshot with every journal record applied, so that a crash between
+// the two writes is harmless: each record sets or deletes whole entries,
+// and replaying all of them again onto idx yields idx.
+func (s *FileStore) compact(idx IndexList) error {
+    b, err := json.Marshal(idx)
+    if err != nil {
+        return err
+    }
+    path, err := s.getIndexPath()
+    if err != nil {
+        return err
+    }
+    version := highestVersion(s.maxVersion, idx)
+    s.state = nil
+    // The snapshot drops deleted entries, so their versions are kept first.
+    if version > 0 {
+        v := []byte(strconv.FormatUint(version, 10))
+        if err = writeFileAtomic(s.getVersionPath(), v, s.FileMode); err != nil {
+            return err
+        }
+    }
+    if err = writeFileAtomic(path, b, s.FileMode); err != nil {
+        return err
+    }
+    if s.afterSnapshot != nil {
+        s.afterSnapshot()
+    }
+    if err = writeFileAtomic(s.getJournalPath(), nil, s.FileMode); err != nil {
+        return err
+    }
+    s.state = copyIndexList(idx)
+    s.maxVersion = version
+    s.journalValid = 0
+    s.journalRecords = 0
+    s.files, _ = s.stat()
+    return nil
+}
+
+// Compact folds the index journal into the snapshot.
+func (s *FileStore) Compact() error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    err := s.replay()
+    if err == IndexFileNotFound {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    return s.compact(s.state)
+}
+
+// MaxVersion returns the highest version the index has held.
+func (s *FileStore) MaxVersion() (uint64, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if err := s.replay(); err != nil && err != IndexFileNotFound {
+        return 0, err
+    }
+    return s.maxVersion, nil
+}
+
+// readVersion reads the version kept by compact, or zero if there is none.
+func (s *FileStore) readVersion() (uint64, error) {
+    b, err := ioutil.ReadFile(s.getVersionPath())
+    if err != nil {
+        if os.IsNotExist(err) {
+            return 0, nil
+        }
+        return 0, err
+    }
+    return strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+}
+
+// highestVersion returns the highest of v and the versions of the entries
+// that rec sets, or deletes from idx.
+func (rec journalRecord) highestVersion(idx IndexList, v uint64) uint64 {
+    for _, entry := range rec.Set {
+        if entry.Version > v {
+            v = entry.Version
+        }
+    }
+    for _, key := range rec.Delete {
+        if entry, exists := idx[key]; exists && entry.Version > v {
+            v = entry.Version
+        }
+    }
+    return v
+}
+
+func (rec journalRecord) apply(idx IndexList) {
+    for _, entry := range rec.Set {
+        idx[entry.Key] = entry
+    }
+    for _, key := range rec.Delete {
+        delete(idx, key)
+    }
+}
+
+// diffIndex returns the record that turns from into to.
+func diffIndex(from, to IndexList) journalRecord {
+    var rec journalRecord
+    for key, entry := range to {
+        if old, exists := from[key]; !exists || old != entry {
+            rec.Set = append(rec.Set, entry)
+        }
+    }
+    for key := range from {
+        if _, exists := to[key]; !exists {
+            rec.Delete = append(rec.Delete, key)
+        }
+    }
+    return rec
+}
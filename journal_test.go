@@ -0,0 +1,188 @@
+package honoka
+
+import (
+    "bytes"
+    "io/ioutil"
+    "os"
+    "testing"
+)
+
+func TestIndexJournal(t *testing.T) {
+    dir := t.TempDir()
+    store := NewFileStore(dir)
+    idx := IndexList{}
+    for _, key := range []string{"foo", "bar", "fizz"} {
+        idx[key] = Index{Key: key, Bucket: key, Expiration: 100}
+        if err := store.SaveIndex(idx); err != nil {
+            t.Fatalf("occurred error when save index: %v", err)
+        }
+    }
+    delete(idx, "bar")
+    if err := store.SaveIndex(idx); err != nil {
+        t.Fatalf("occurred error when save index: %v", err)
+    }
+
+    journal, _ := ioutil.ReadFile(store.getJournalPath())
+    if lines := bytes.Count(journal, []byte("\n")); lines != 3 {
+        t.Errorf("actual does not match expected. actual: %d records , expected: %d records", lines, 3)
+    }
+
+    // A crash in the middle of an append leaves a torn record behind.
+    f, _ := os.OpenFile(store.getJournalPath(), os.O_APPEND|os.O_WRONLY, 0644)
+    f.Write([]byte(`{"set":[{"Key":"torn"`))
+    f.Close()
+
+    reopened := NewFileStore(dir)
+    loaded, err := reopened.LoadIndex()
+    if err != nil {
+        t.Fatalf("occurred error when load index: %v", err)
+    }
+    if len(loaded) != 2 || loaded["foo"] != idx["foo"] || loaded["fizz"] != idx["fizz"] {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", loaded, idx)
+    }
+
+    loaded["buzz"] = Index{Key: "buzz", Bucket: "buzz", Expiration: 100}
+    if err = reopened.SaveIndex(loaded); err != nil {
+        t.Fatalf("occurred error when save index: %v", err)
+    }
+    loaded, err = NewFileStore(dir).LoadIndex()
+    if err != nil || len(loaded) != 3 {
+        t.Errorf("record after torn write is lost: %v (%v)", loaded, err)
+    }
+}
+
+func TestIndexJournalCompaction(t *testing.T) {
+    dir := t.TempDir()
+    store := NewFileStore(dir)
+    store.MaxJournal = 3
+    idx := IndexList{}
+    for _, key := range []string{"a", "b", "c", "d", "e"} {
+        idx[key] = Index{Key: key, Bucket: key, Expiration: 100}
+        if err := store.SaveIndex(idx); err != nil {
+            t.Fatalf("occurred error when save index: %v", err)
+        }
+    }
+    journal, _ := ioutil.ReadFile(store.getJournalPath())
+    if lines := bytes.Count(journal, []byte("\n")); lines >= 3 {
+        t.Errorf("journal is not compacted: %d records", lines)
+    }
+    loaded, err := NewFileStore(dir).LoadIndex()
+    if err != nil || len(loaded) != 5 {
+        t.Errorf("actual does not match expected. actual: %v (%v) , expected: %v", loaded, err, idx)
+    }
+
+    if err = store.Compact(); err != nil {
+        t.Fatalf("occurred error when compact index: %v", err)
+    }
+    journal, _ = ioutil.ReadFile(store.getJournalPath())
+    if len(journal) != 0 {
+        t.Errorf("journal is not empty after compaction: %s", journal)
+    }
+}
+
+func TestIndexJournalCompactionCrash(t *testing.T) {
+    dir := t.TempDir()
+    store := NewFileStore(dir)
+    store.MaxJournal = 3
+    var journal []byte
+    store.afterSnapshot = func() {
+        journal, _ = ioutil.ReadFile(store.getJournalPath())
+    }
+    saves := []IndexList{
+        {"foo": Index{Key: "foo", Bucket: "v1"}, "gone": Index{Key: "gone", Bucket: "gone"}},
+        {"foo": Index{Key: "foo", Bucket: "v2"}, "gone": Index{Key: "gone", Bucket: "gone"}},
+        {"foo": Index{Key: "foo", Bucket: "v3"}},
+        {"foo": Index{Key: "foo", Bucket: "v4"}},
+    }
+    for _, idx := range saves {
+        if err := store.SaveIndex(idx); err != nil {
+            t.Fatalf("occurred error when save index: %v", err)
+        }
+    }
+    if journal == nil {
+        t.Fatal("index is not compacted")
+    }
+
+    // A crash after the snapshot was written leaves the old journal behind.
+    if err := ioutil.WriteFile(store.getJournalPath(), journal, 0644); err != nil {
+        t.Fatalf("occurred error when restore journal: %v", err)
+    }
+    loaded, err := NewFileStore(dir).LoadIndex()
+    if err != nil {
+        t.Fatalf("occurred error when load index: %v", err)
+    }
+    if len(loaded) != 1 || loaded["foo"].Bucket != "v4" {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", loaded, saves[3])
+    }
+}
+
+func TestFileStoreEntries(t *testing.T) {
+    dir := t.TempDir()
+    store := NewFileStore(dir)
+    foo := Index{Key: "foo", Bucket: "foo1", Expiration: 100}
+    bar := Index{Key: "bar", Bucket: "bar1", Expiration: 100}
+    for _, entry := range []Index{foo, bar} {
+        if err := store.PutEntry(entry, []byte(entry.Key)); err != nil {
+            t.Fatalf("occurred error when put entry: %v", err)
+        }
+    }
+    if err := store.DeleteEntry("foo"); err != nil {
+        t.Fatalf("occurred error when delete entry: %v", err)
+    }
+    if err := store.DeleteEntry("missing"); err != nil {
+        t.Errorf("occurred error when delete missing entry: %v", err)
+    }
+
+    journal, _ := ioutil.ReadFile(store.getJournalPath())
+    if lines := bytes.Count(journal, []byte("\n")); lines != 2 {
+        t.Errorf("actual does not match expected. actual: %d records , expected: %d records", lines, 2)
+    }
+    if _, err := store.ReadBucket("foo1"); err != BucketFileNotFound {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, BucketFileNotFound)
+    }
+    reopened := NewFileStore(dir)
+    entry, exists, err := reopened.LoadEntry("bar")
+    if err != nil || !exists || entry != bar {
+        t.Errorf("actual does not match expected. actual: %v (%v) , expected: %v", entry, err, bar)
+    }
+    if _, exists, _ = reopened.LoadEntry("foo"); exists {
+        t.Errorf("deleted entry is loaded")
+    }
+}
+
+// countingFileStore counts the calls that read or write the whole index.
+type countingFileStore struct {
+    *FileStore
+    loads, saves int
+}
+
+func (s *countingFileStore) LoadIndex() (IndexList, error) {
+    s.loads++
+    return s.FileStore.LoadIndex()
+}
+
+func (s *countingFileStore) SaveIndex(idx IndexList) error {
+    s.saves++
+    return s.FileStore.SaveIndex(idx)
+}
+
+func TestFileStoreWritesEntries(t *testing.T) {
+    store := &countingFileStore{FileStore: NewFileStore(t.TempDir())}
+    cli := newTestClient(t, WithStore(store))
+    store.loads = 0
+    for _, val := range []string{"foo", "bar"} {
+        if err := cli.Put("testEntries", val, 100); err != nil {
+            t.Fatalf("occurred error when put cache: %v", err)
+        }
+    }
+    if err := cli.Delete("testEntries"); err != nil {
+        t.Fatalf("occurred error when delete cache: %v", err)
+    }
+    if store.loads != 0 || store.saves != 0 {
+        t.Errorf("whole index is used for single writes. loads: %d , saves: %d", store.loads, store.saves)
+    }
+    buckets, err := store.ListBuckets()
+    if err != nil || len(buckets) != 0 {
+        t.Errorf("buckets are left behind: %v (%v)", buckets, err)
+    }
+}
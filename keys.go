@@ -0,0 +1,109 @@
+package honoka
+
+import (
+    "context"
+    "regexp"
+    "sort"
+    "strings"
+)
+
+// Keys returns the sorted keys of the index that match pattern, expired
+// ones included. In pattern, '*' matches any run of characters and '?'
+// any single character, so "github:repo:*" selects every key with that
+// prefix.
+//
+// Example:
+//   cli, err := honoka.New()
+//   keys, err := cli.Keys("github:repo:*")
+func (c *Client) Keys(pattern string) ([]string, error) {
+    list, err := c.ListMatching(pattern)
+    if err != nil {
+        return nil, err
+    }
+    var keys []string
+    for _, i := range list {
+        keys = append(keys, i.Key)
+    }
+    return keys, nil
+}
+
+// ListMatching is List for the keys that match pattern, see Keys, sorted
+// by key.
+//
+// Example:
+//   cli, err := honoka.New()
+//   list, err := cli.ListMatching("github:repo:*")
+func (c *Client) ListMatching(pattern string) ([]Index, error) {
+    match := compilePattern(pattern)
+    idx, err := c.getIndexer(true)
+    if err != nil {
+        return nil, err
+    }
+    var list []Index
+    for key, i := range idx {
+        if match(key) {
+            list = append(list, i)
+        }
+    }
+    sort.Slice(list, func(a, b int) bool {
+        return list[a].Key < list[b].Key
+    })
+    return list, nil
+}
+
+// DeleteMatching deletes every cache whose key matches pattern, see Keys,
+// with a single index update, and returns the deleted keys.
+//
+// Example:
+//   cli, err := honoka.New()
+//   deleted, err := cli.DeleteMatching("github:repo:*")
+func (c *Client) DeleteMatching(pattern string) ([]string, error) {
+    return c.DeleteMatchingContext(context.Background(), pattern)
+}
+
+// DeleteMatchingContext is DeleteMatching that gives up waiting for the
+// index lock when ctx is done.
+func (c *Client) DeleteMatchingContext(ctx context.Context, pattern string) ([]string, error) {
+    match := compilePattern(pattern)
+    unlock, err := c.lockIndexContext(ctx)
+    if err != nil {
+        return nil, err
+    }
+    defer unlock()
+
+    idx, err := c.loadIndexer()
+    if err != nil {
+        return nil, err
+    }
+    conds := make(map[string]func(Index) bool)
+    for key := range idx {
+        if match(key) {
+            conds[key] = nil
+        }
+    }
+    return c.removeEntries(idx, conds)
+}
+
+// compilePattern returns a matcher for a key pattern. Patterns without
+// wildcards match only the key itself.
+func compilePattern(pattern string) func(string) bool {
+    if !strings.ContainsAny(pattern, "*?") {
+        return func(key string) bool {
+            return key == pattern
+        }
+    }
+    var expr strings.Builder
+    expr.WriteString("^")
+    for _, r := range pattern {
+        switch r {
+        case '*':
+            expr.WriteString("(?s:.*)")
+        case '?':
+            expr.WriteString("(?s:.)")
+        default:
+            expr.WriteString(regexp.QuoteMeta(string(r)))
+        }
+    }
+    expr.WriteString("$")
+    return regexp.MustCompile(expr.String()).MatchString
+}
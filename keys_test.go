@@ -0,0 +1,68 @@
+package honoka
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestKeys(t *testing.T) {
+    cli := newTestClient(t)
+    for _, key := range []string{"github:repo:foo", "github:repo:bar/baz", "github:user:foo", "gitlab:repo:foo"} {
+        if err := cli.Set(key, key, 100); err != nil {
+            t.Fatalf("occurred error when set cache: %v", err)
+        }
+    }
+
+    cases := map[string][]string{
+        "github:repo:*":   {"github:repo:bar/baz", "github:repo:foo"},
+        "git???:repo:foo": {"github:repo:foo", "gitlab:repo:foo"},
+        "*:foo":           {"github:repo:foo", "github:user:foo", "gitlab:repo:foo"},
+        "github:user:foo": {"github:user:foo"},
+        "github:":         nil,
+    }
+    for pattern, expected := range cases {
+        actual, err := cli.Keys(pattern)
+        if err != nil || !reflect.DeepEqual(actual, expected) {
+            t.Errorf("actual does not match expected. actual: %v (%v) , expected: %v (%s)", actual, err, expected, pattern)
+        }
+    }
+
+    list, err := cli.ListMatching("github:repo:*")
+    if err != nil || len(list) != 2 || list[0].Key != "github:repo:bar/baz" || list[1].Key != "github:repo:foo" || list[0].Bucket == "" {
+        t.Errorf("actual does not match expected. actual: %v (%v) , expected: %s", list, err, "entries of github:repo:*")
+    }
+
+    deleted, err := cli.DeleteMatching("github:repo:*")
+    expected := []string{"github:repo:bar/baz", "github:repo:foo"}
+    if err != nil || !reflect.DeepEqual(deleted, expected) {
+        t.Errorf("actual does not match expected. actual: %v (%v) , expected: %v", deleted, err, expected)
+    }
+    if _, err = cli.GetJson("github:repo:foo"); err != CacheIsExpired {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, CacheIsExpired)
+    }
+    if keys, _ := cli.Keys("*"); len(keys) != 2 {
+        t.Errorf("actual does not match expected. actual: %v , expected: %d keys", keys, 2)
+    }
+}
+
+func TestDeleteMatchingFileStore(t *testing.T) {
+    store := NewFileStore(t.TempDir())
+    cli := newTestClient(t, WithStore(store))
+    for _, key := range []string{"webhook:1", "webhook:2", "webhook:3", "other"} {
+        if err := cli.Set(key, key, 100); err != nil {
+            t.Fatalf("occurred error when set cache: %v", err)
+        }
+    }
+
+    records := countRecords(t, store)
+    deleted, err := cli.DeleteMatching("webhook:*")
+    if err != nil || len(deleted) != 3 {
+        t.Fatalf("actual does not match expected. actual: %v (%v) , expected: %d keys", deleted, err, 3)
+    }
+    if n := countRecords(t, store) - records; n != 1 {
+        t.Errorf("actual does not match expected. actual: %d records , expected: %d records", n, 1)
+    }
+    if keys, _ := cli.Keys("*"); len(keys) != 1 || keys[0] != "other" {
+        t.Errorf("actual does not match expected. actual: %v , expected: %s", keys, "other")
+    }
+}
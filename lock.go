@@ -0,0 +1,50 @@
+package honoka
+
+import (
+    "context"
+    "errors"
+    "time"
+)
+
+const (
+    defaultLockTimeout = 10 * time.Second
+    lockRetryInterval  = 10 * time.Millisecond
+)
+
+var (
+    // ErrLockTimeout is returned when the index lock could not be acquired
+    // within the lock timeout (see WithLockTimeout).
+    ErrLockTimeout = errors.New("honoka: timed out waiting for index lock")
+
+    errLockBusy = errors.New("honoka: index lock is held by another process")
+)
+
+// WithLockTimeout sets how long index mutations wait for the cross-process
+// index lock before failing with ErrLockTimeout. Zero means try once.
+func WithLockTimeout(timeout time.Duration) Option {
+    return func(c *Client) error {
+        if timeout < 0 {
+            return errors.New("honoka: lock timeout must not be negative")
+        }
+        c.lockTimeout = timeout
+        return nil
+    }
+}
+
+// lockIndex takes the lock that guards read-modify-write of the index.
+// The returned function releases it.
+func (c *Client) lockIndex() (func(), error) {
+    return c.lockIndexContext(context.Background())
+}
+
+// lockIndexContext is lockIndex that gives up when ctx is done. Stores
+// that do not implement ContextLocker are only checked before waiting.
+func (c *Client) lockIndexContext(ctx context.Context) (func(), error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    if locker, ok := c.store.(ContextLocker); ok {
+        return locker.LockContext(ctx, c.lockTimeout)
+    }
+    return c.store.Lock(c.lockTimeout)
+}
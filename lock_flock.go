@@ -0,0 +1,35 @@
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package honoka
+
+import (
+    "os"
+    "syscall"
+)
+
+type fileLock struct {
+    f *os.File
+}
+
+// lockFile takes an exclusive flock(2) on path without blocking.
+// It returns errLockBusy if another process holds the lock.
+func lockFile(path string, perm os.FileMode) (*fileLock, error) {
+    f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, perm)
+    if err != nil {
+        return nil, err
+    }
+    err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+    if err != nil {
+        f.Close()
+        if err == syscall.EWOULDBLOCK {
+            return nil, errLockBusy
+        }
+        return nil, err
+    }
+    return &fileLock{f: f}, nil
+}
+
+func (l *fileLock) unlock() {
+    syscall.Flock(int(l.f.Fd()), syscall.LOCK_UN)
+    l.f.Close()
+}
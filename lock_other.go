@@ -0,0 +1,30 @@
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package honoka
+
+import (
+    "os"
+)
+
+type fileLock struct {
+    path string
+}
+
+// lockFile creates path exclusively and treats its existence as the lock.
+// It returns errLockBusy if the file already exists. A process that crashes
+// while holding the lock leaves the file behind; remove it by hand.
+func lockFile(path string, perm os.FileMode) (*fileLock, error) {
+    f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+    if err != nil {
+        if os.IsExist(err) {
+            return nil, errLockBusy
+        }
+        return nil, err
+    }
+    f.Close()
+    return &fileLock{path: path}, nil
+}
+
+func (l *fileLock) unlock() {
+    os.Remove(l.path)
+}
@@ -0,0 +1,57 @@
+package honoka
+
+import (
+    "path/filepath"
+    "strconv"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestLockTimeout(t *testing.T) {
+    cli := newTestClient(t, WithLockTimeout(50 * time.Millisecond))
+
+    l, err := lockFile(filepath.Join(cli.Dir(), "index.lock"), 0644)
+    if err != nil {
+        t.Fatalf("occurred error when lock index: %v", err)
+    }
+    err = cli.Set("testLock", "foobar", 100)
+    if err != ErrLockTimeout {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, ErrLockTimeout)
+    }
+
+    l.unlock()
+    err = cli.Set("testLock", "foobar", 100)
+    if err != nil {
+        t.Errorf("occurred error when set cache after unlock: %v", err)
+    }
+}
+
+func TestConcurrentClientsKeepEntries(t *testing.T) {
+    dir := t.TempDir()
+    var clients []*Client
+    for i := 0; i < 20; i++ {
+        clients = append(clients, newTestClient(t, WithDir(dir)))
+    }
+
+    var wg sync.WaitGroup
+    for i, cli := range clients {
+        wg.Add(1)
+        go func(i int, cli *Client) {
+            defer wg.Done()
+            if err := cli.Set("key"+strconv.Itoa(i), i, 100); err != nil {
+                t.Errorf("occurred error when set cache: %v", err)
+            }
+        }(i, cli)
+    }
+    wg.Wait()
+
+    cli := newTestClient(t, WithDir(dir))
+    list, err := cli.List()
+    if err != nil {
+        t.Fatalf("occurred error when list cache: %v", err)
+    }
+    if len(list) != 20 {
+        t.Errorf("actual does not match expected. actual: %d , expected: %d", len(list), 20)
+    }
+}
@@ -0,0 +1,109 @@
+package honoka
+
+import (
+    "errors"
+    "sort"
+)
+
+// WithMaxBytes caps the total size of bucket files. When a Set or Update
+// would exceed it, least recently used entries are evicted.
+func WithMaxBytes(n int64) Option {
+    return func(c *Client) error {
+        if n < 0 {
+            return errors.New("honoka: max bytes must not be negative")
+        }
+        c.maxBytes = n
+        return nil
+    }
+}
+
+// WithMaxEntries caps the number of index entries. When a Set or Update
+// would exceed it, least recently used entries are evicted.
+func WithMaxEntries(n int) Option {
+    return func(c *Client) error {
+        if n < 0 {
+            return errors.New("honoka: max entries must not be negative")
+        }
+        c.maxEntries = n
+        return nil
+    }
+}
+
+func (c *Client) bounded() bool {
+    return c.maxBytes > 0 || c.maxEntries > 0
+}
+
+// touch records a read of key. Reads are written to the index with the
+// next index update rather than on every read.
+func (c *Client) touch(key string) {
+    if !c.bounded() {
+        return
+    }
+    c.mu.Lock()
+    if c.accessed == nil {
+        c.accessed = make(map[string]int64)
+    }
+    c.accessed[key] = c.now().UnixNano()
+    c.mu.Unlock()
+}
+
+// applyAccesses merges the reads recorded by touch into idx.
+// The caller must hold the index lock.
+func (c *Client) applyAccesses(idx IndexList) {
+    c.mu.Lock()
+    accessed := c.accessed
+    c.accessed = nil
+    c.mu.Unlock()
+
+    for key, at := range accessed {
+        if entry, exists := idx[key]; exists && entry.Accessed < at {
+            entry.Accessed = at
+            idx[key] = entry
+        }
+    }
+}
+
+// evict removes entries from idx, and their buckets, until the size limits
+// hold. Entries that can be removed anyway go first, then the least
+// recently used ones. The entries of keep are never evicted.
+// The caller must hold the index lock.
+func (c *Client) evict(idx IndexList, keep ...string) error {
+    if !c.bounded() {
+        return nil
+    }
+    c.applyAccesses(idx)
+
+    kept := make(map[string]bool, len(keep))
+    for _, key := range keep {
+        kept[key] = true
+    }
+    var total int64
+    candidates := make([]Index, 0, len(idx))
+    for key, entry := range idx {
+        total += entry.Size
+        if !kept[key] {
+            candidates = append(candidates, entry)
+        }
+    }
+    sort.Slice(candidates, func(i, j int) bool {
+        ri, rj := c.removable(candidates[i]), c.removable(candidates[j])
+        if ri != rj {
+            return ri
+        }
+        return candidates[i].Accessed < candidates[j].Accessed
+    })
+
+    for _, entry := range candidates {
+        overBytes := c.maxBytes > 0 && total > c.maxBytes
+        overEntries := c.maxEntries > 0 && len(idx) > c.maxEntries
+        if !overBytes && !overEntries {
+            break
+        }
+        if err := c.store.DeleteBucket(entry.Bucket); err != nil {
+            return err
+        }
+        delete(idx, entry.Key)
+        total -= entry.Size
+    }
+    return nil
+}
@@ -0,0 +1,65 @@
+package honoka
+
+import (
+    "strconv"
+    "testing"
+    "time"
+)
+
+func TestEvictLeastRecentlyUsed(t *testing.T) {
+    now := time.Unix(1000, 0)
+    clock := func() time.Time { return now }
+    cli := newTestClient(t, WithClock(clock), WithMaxEntries(3))
+
+    for i := 0; i < 3; i++ {
+        if err := cli.Set("key"+strconv.Itoa(i), i, 100); err != nil {
+            t.Fatalf("occurred error when set cache: %v", err)
+        }
+        now = now.Add(time.Second)
+    }
+    // key0 becomes the most recently used one.
+    if _, err := cli.GetJson("key0"); err != nil {
+        t.Fatalf("occurred error when get cache: %v", err)
+    }
+    now = now.Add(time.Second)
+
+    if err := cli.Set("key3", 3, 100); err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+    list, _ := cli.List()
+    if len(list) != 3 {
+        t.Errorf("actual does not match expected. actual: %d , expected: %d", len(list), 3)
+    }
+    if _, exists := cli.lookup("key1"); exists {
+        t.Errorf("least recently used entry is not evicted")
+    }
+    for _, key := range []string{"key0", "key2", "key3"} {
+        if _, exists := cli.lookup(key); !exists {
+            t.Errorf("entry is evicted: %s", key)
+        }
+    }
+    outdated, _ := cli.Outdated()
+    if len(outdated) != 0 {
+        t.Errorf("evicted bucket is left: %v", outdated)
+    }
+}
+
+func TestEvictBySize(t *testing.T) {
+    cli := newTestClient(t, WithMaxBytes(20))
+    for i := 0; i < 5; i++ {
+        if err := cli.Set("key"+strconv.Itoa(i), "0123456789", 100); err != nil {
+            t.Fatalf("occurred error when set cache: %v", err)
+        }
+    }
+    var total int64
+    list, _ := cli.List()
+    for _, idx := range list {
+        total += idx.Size
+    }
+    if total > 20 {
+        t.Errorf("total size exceeds the limit: %d", total)
+    }
+    if _, exists := cli.lookup("key4"); !exists {
+        t.Errorf("latest entry is evicted")
+    }
+}
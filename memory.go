@@ -0,0 +1,237 @@
+package honoka
+
+import (
+    "container/list"
+    "errors"
+    "reflect"
+    "sync"
+)
+
+// memoryTier is a bounded in-process cache of bucket payloads, and of the
+// values decoded from them, in front of the files. An item is only valid
+// while the index entry of its key still points at the same bucket, so it
+// shares the entry's expiration.
+// A nil *memoryTier is a disabled tier.
+type memoryTier struct {
+    mu    sync.Mutex
+    max   int
+    order *list.List
+    items map[string]*list.Element
+}
+
+type memoryItem struct {
+    key    string
+    bucket string
+    value  cached
+
+    // Values decoded from value by the typed functions, by type.
+    decoded map[reflect.Type]interface{}
+}
+
+// WithMemoryTier keeps up to maxEntries caches in memory, so that repeated
+// reads of hot keys skip the bucket files. Each keeps the payload, already
+// read, decompressed and verified, and the values the typed functions
+// such as Get[T] decoded from it, which later calls for the same type
+// return without decoding again. The untyped Client.Get and
+// GetWithVersion keep the value they decode from JSON the same way;
+// GetJson and GetMulti return the payload itself. Kept values are copied
+// on every read, so callers own what they get, except for unexported
+// struct fields, which are copied shallowly. The least recently used cache
+// is dropped when it is full.
+//
+// Example:
+//   cli, err := honoka.New(honoka.WithMemoryTier(1000))
+func WithMemoryTier(maxEntries int) Option {
+    return func(c *Client) error {
+        if maxEntries <= 0 {
+            return errors.New("honoka: memory tier size must be positive")
+        }
+        c.memory = &memoryTier{
+            max:   maxEntries,
+            order: list.New(),
+            items: make(map[string]*list.Element),
+        }
+        return nil
+    }
+}
+
+// get returns a copy of the payload of key if it was read from bucket.
+func (m *memoryTier) get(key, bucket string) (cached, bool) {
+    if m == nil {
+        return cached{}, false
+    }
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    el, exists := m.items[key]
+    if !exists {
+        return cached{}, false
+    }
+    item := el.Value.(*memoryItem)
+    if item.bucket != bucket {
+        m.order.Remove(el)
+        delete(m.items, key)
+        return cached{}, false
+    }
+    m.order.MoveToFront(el)
+    return item.value.copy(), true
+}
+
+// getDecoded returns a copy of the value of type typ decoded from the
+// payload of key, with the version of the payload, if it was read from
+// bucket.
+func (m *memoryTier) getDecoded(key, bucket string, typ reflect.Type) (interface{}, uint64, bool) {
+    if m == nil {
+        return nil, 0, false
+    }
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    el, exists := m.items[key]
+    if !exists {
+        return nil, 0, false
+    }
+    item := el.Value.(*memoryItem)
+    v, decoded := item.decoded[typ]
+    if item.bucket != bucket || !decoded {
+        return nil, 0, false
+    }
+    m.order.MoveToFront(el)
+    return copyDecoded(v), item.value.version, true
+}
+
+// getDecodedVersion is getDecoded for a payload of the given version.
+func (m *memoryTier) getDecodedVersion(key string, version uint64, typ reflect.Type) (interface{}, bool) {
+    if m == nil {
+        return nil, false
+    }
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    el, exists := m.items[key]
+    if !exists {
+        return nil, false
+    }
+    item := el.Value.(*memoryItem)
+    v, decoded := item.decoded[typ]
+    if item.value.version != version || !decoded {
+        return nil, false
+    }
+    m.order.MoveToFront(el)
+    return copyDecoded(v), true
+}
+
+// putDecoded keeps a copy of v, decoded into typ, with the payload of key
+// if that still has the given version.
+func (m *memoryTier) putDecoded(key string, version uint64, typ reflect.Type, v interface{}) {
+    if m == nil {
+        return
+    }
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    el, exists := m.items[key]
+    if !exists {
+        return
+    }
+    item := el.Value.(*memoryItem)
+    if item.value.version != version {
+        return
+    }
+    if item.decoded == nil {
+        item.decoded = make(map[reflect.Type]interface{})
+    }
+    item.decoded[typ] = copyDecoded(v)
+}
+
+// copyDecoded returns a deep copy of a decoded value, so that a kept value
+// never shares slices, maps or pointers with a caller. Decoded values have
+// no cycles.
+func copyDecoded(v interface{}) interface{} {
+    if v == nil {
+        return nil
+    }
+    return copyValue(reflect.ValueOf(v)).Interface()
+}
+
+func copyValue(v reflect.Value) reflect.Value {
+    switch v.Kind() {
+    case reflect.Ptr:
+        if v.IsNil() {
+            return v
+        }
+        c := reflect.New(v.Type().Elem())
+        c.Elem().Set(copyValue(v.Elem()))
+        return c
+    case reflect.Interface:
+        if v.IsNil() {
+            return v
+        }
+        c := reflect.New(v.Type()).Elem()
+        c.Set(copyValue(v.Elem()))
+        return c
+    case reflect.Slice:
+        if v.IsNil() {
+            return v
+        }
+        c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+        for i := 0; i < v.Len(); i++ {
+            c.Index(i).Set(copyValue(v.Index(i)))
+        }
+        return c
+    case reflect.Map:
+        if v.IsNil() {
+            return v
+        }
+        c := reflect.MakeMapWithSize(v.Type(), v.Len())
+        iter := v.MapRange()
+        for iter.Next() {
+            c.SetMapIndex(iter.Key(), copyValue(iter.Value()))
+        }
+        return c
+    case reflect.Array:
+        c := reflect.New(v.Type()).Elem()
+        for i := 0; i < v.Len(); i++ {
+            c.Index(i).Set(copyValue(v.Index(i)))
+        }
+        return c
+    case reflect.Struct:
+        c := reflect.New(v.Type()).Elem()
+        c.Set(v)
+        for i := 0; i < v.NumField(); i++ {
+            if f := c.Field(i); f.CanSet() {
+                f.Set(copyValue(v.Field(i)))
+            }
+        }
+        return c
+    }
+    return v
+}
+
+func (m *memoryTier) put(key, bucket string, value cached) {
+    if m == nil {
+        return
+    }
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    item := &memoryItem{key: key, bucket: bucket, value: value.copy()}
+    if el, exists := m.items[key]; exists {
+        el.Value = item
+        m.order.MoveToFront(el)
+        return
+    }
+    m.items[key] = m.order.PushFront(item)
+    for m.order.Len() > m.max {
+        last := m.order.Back()
+        m.order.Remove(last)
+        delete(m.items, last.Value.(*memoryItem).key)
+    }
+}
+
+func (m *memoryTier) remove(key string) {
+    if m == nil {
+        return
+    }
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if el, exists := m.items[key]; exists {
+        m.order.Remove(el)
+        delete(m.items, key)
+    }
+}
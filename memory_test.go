@@ -0,0 +1,148 @@
+package honoka
+
+import (
+    "os"
+    "reflect"
+    "testing"
+    "time"
+)
+
+func TestMemoryTier(t *testing.T) {
+    cli := newTestClient(t, WithMemoryTier(2))
+    if err := cli.Set("testMemory", "foobar", 100); err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+
+    // Served from memory even though the bucket file is gone.
+    idx, _ := cli.lookup("testMemory")
+    path, _ := fileStore(cli).getBucketPath(idx.Bucket)
+    os.Remove(path)
+    b, err := cli.GetJson("testMemory")
+    if err != nil {
+        t.Fatalf("occurred error when get cache: %v", err)
+    }
+    if string(b) != "\"foobar\"" {
+        t.Errorf("actual does not match expected. actual: %s , expected: %s", b, "\"foobar\"")
+    }
+
+    if err := cli.Delete("testMemory"); err != nil {
+        t.Fatalf("occurred error when delete cache: %v", err)
+    }
+    if _, err := cli.GetJson("testMemory"); err != CacheIsExpired {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, CacheIsExpired)
+    }
+}
+
+func TestMemoryTierBounded(t *testing.T) {
+    cli := newTestClient(t, WithMemoryTier(2))
+    m := cli.memory
+    for _, key := range []string{"a", "b", "c"} {
+        m.put(key, key, cached{data: []byte(key)})
+    }
+    if _, hit := m.get("a", "a"); hit {
+        t.Errorf("least recently used item is not dropped")
+    }
+    if v, hit := m.get("c", "c"); !hit || string(v.data) != "c" {
+        t.Errorf("actual does not match expected. actual: %s , expected: %s", v.data, "c")
+    }
+    if _, hit := m.get("c", "other"); hit {
+        t.Errorf("item of another bucket is served")
+    }
+}
+
+func TestMemoryTierDecoded(t *testing.T) {
+    type repository struct {
+        Name  string
+        Stars int
+    }
+    cli := newTestClient(t, WithMemoryTier(2))
+    if err := cli.Set("testDecoded", repository{Name: "honoka", Stars: 1}, 100); err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+    if _, err := Get[repository](cli, "testDecoded"); err != nil {
+        t.Fatalf("occurred error when get cache: %v", err)
+    }
+
+    // The decoded value is served without decoding the payload again.
+    idx, _ := cli.lookup("testDecoded")
+    cli.memory.items["testDecoded"].Value.(*memoryItem).value.data = []byte("broken")
+    actual, version, err := GetWithVersion[repository](cli, "testDecoded")
+    if err != nil || actual.Name != "honoka" || version != idx.Version {
+        t.Errorf("actual does not match expected. actual: %v %d (%v) , expected: %v %d", actual, version, err, "honoka", idx.Version)
+    }
+    if b, _ := cli.GetJson("testDecoded"); string(b) != "broken" {
+        t.Errorf("untyped read does not use the payload: %s", b)
+    }
+
+    // A new write drops the decoded value of the previous one.
+    if err = cli.Put("testDecoded", repository{Name: "honoka", Stars: 2}, 100); err != nil {
+        t.Fatalf("occurred error when put cache: %v", err)
+    }
+    if _, _, hit := cli.memory.getDecoded("testDecoded", idx.Bucket, reflect.TypeOf(repository{})); hit {
+        t.Errorf("decoded value of a replaced bucket is served")
+    }
+    actual, err = Get[repository](cli, "testDecoded")
+    if err != nil || actual.Stars != 2 {
+        t.Errorf("actual does not match expected. actual: %v (%v) , expected: %d stars", actual, err, 2)
+    }
+}
+
+func TestMemoryTierDecodedNotShared(t *testing.T) {
+    cli := newTestClient(t, WithMemoryTier(2))
+    if err := cli.Set("testShared", []int{1, 2, 3}, 100); err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+    v, err := Get[[]int](cli, "testShared")
+    if err != nil {
+        t.Fatalf("occurred error when get cache: %v", err)
+    }
+    var output interface{}
+    u, err := cli.Get("testShared", &output)
+    if err != nil {
+        t.Fatalf("occurred error when get cache: %v", err)
+    }
+
+    // Both values are kept, and served without decoding the payload again.
+    cli.memory.items["testShared"].Value.(*memoryItem).value.data = []byte("broken")
+    v[0] = 99
+    u.([]interface{})[0] = 99
+    actual, err := Get[[]int](cli, "testShared")
+    if err != nil || !reflect.DeepEqual(actual, []int{1, 2, 3}) {
+        t.Errorf("actual does not match expected. actual: %v (%v) , expected: %v", actual, err, []int{1, 2, 3})
+    }
+    var untyped interface{}
+    if _, err = cli.Get("testShared", &untyped); err != nil || !reflect.DeepEqual(untyped, []interface{}{1.0, 2.0, 3.0}) {
+        t.Errorf("actual does not match expected. actual: %v (%v) , expected: %v", untyped, err, []int{1, 2, 3})
+    }
+    values, err := GetMulti[[]int](cli, []string{"testShared"})
+    if err != nil || !reflect.DeepEqual(values["testShared"], []int{1, 2, 3}) {
+        t.Errorf("actual does not match expected. actual: %v (%v) , expected: %v", values, err, []int{1, 2, 3})
+    }
+}
+
+func TestCopyDecoded(t *testing.T) {
+    type inner struct {
+        Tags map[string][]string
+    }
+    type payload struct {
+        Name    string
+        Inner   *inner
+        Items   []interface{}
+        Updated time.Time
+    }
+    orig := payload{
+        Name:    "honoka",
+        Inner:   &inner{Tags: map[string][]string{"a": {"b"}}},
+        Items:   []interface{}{map[string]interface{}{"c": 1.0}},
+        Updated: time.Unix(1000, 0),
+    }
+    c := copyDecoded(orig).(payload)
+    if !reflect.DeepEqual(c, orig) {
+        t.Fatalf("actual does not match expected. actual: %+v , expected: %+v", c, orig)
+    }
+    c.Inner.Tags["a"][0] = "x"
+    c.Items[0].(map[string]interface{})["c"] = 2.0
+    if orig.Inner.Tags["a"][0] != "b" || orig.Items[0].(map[string]interface{})["c"] != 1.0 {
+        t.Errorf("copy shares memory with the original: %+v", orig)
+    }
+}
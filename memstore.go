@@ -0,0 +1,118 @@
+package honoka
+
+import (
+    "context"
+    "sort"
+    "sync"
+    "time"
+)
+
+// MemoryStore keeps the index and buckets in memory. It is meant for unit
+// tests: nothing is persisted and the lock only spans one process.
+type MemoryStore struct {
+    mu      sync.RWMutex
+    buckets map[string][]byte
+    index   IndexList
+    lock    chan struct{}
+
+    // Highest version of any entry saved so far.
+    maxVersion uint64
+
+    namespaces map[string]*MemoryStore
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+    return &MemoryStore{
+        buckets: make(map[string][]byte),
+        lock:    make(chan struct{}, 1),
+    }
+}
+
+func (s *MemoryStore) ReadBucket(name string) ([]byte, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    data, exists := s.buckets[name]
+    if !exists {
+        return nil, BucketFileNotFound
+    }
+    return append([]byte(nil), data...), nil
+}
+
+func (s *MemoryStore) WriteBucket(name string, data []byte) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.buckets[name] = append([]byte(nil), data...)
+    return nil
+}
+
+func (s *MemoryStore) DeleteBucket(name string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    delete(s.buckets, name)
+    return nil
+}
+
+func (s *MemoryStore) ListBuckets() ([]string, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    var list []string
+    for name := range s.buckets {
+        list = append(list, name)
+    }
+    sort.Strings(list)
+    return list, nil
+}
+
+func (s *MemoryStore) LoadIndex() (IndexList, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    if s.index == nil {
+        return nil, IndexFileNotFound
+    }
+    return copyIndexList(s.index), nil
+}
+
+func (s *MemoryStore) SaveIndex(idx IndexList) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.maxVersion = highestVersion(highestVersion(s.maxVersion, s.index), idx)
+    s.index = copyIndexList(idx)
+    return nil
+}
+
+func (s *MemoryStore) MaxVersion() (uint64, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    return s.maxVersion, nil
+}
+
+func (s *MemoryStore) Lock(timeout time.Duration) (func(), error) {
+    return s.LockContext(context.Background(), timeout)
+}
+
+func (s *MemoryStore) LockContext(ctx context.Context, timeout time.Duration) (func(), error) {
+    timer := time.NewTimer(timeout)
+    defer timer.Stop()
+    select {
+    case s.lock <- struct{}{}:
+        return func() { <-s.lock }, nil
+    default:
+    }
+    select {
+    case s.lock <- struct{}{}:
+        return func() { <-s.lock }, nil
+    case <-timer.C:
+        return nil, ErrLockTimeout
+    case <-ctx.Done():
+        return nil, ctx.Err()
+    }
+}
+
+func copyIndexList(idx IndexList) IndexList {
+    list := make(IndexList, len(idx))
+    for key, entry := range idx {
+        list[key] = entry
+    }
+    return list
+}
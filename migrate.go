@@ -0,0 +1,46 @@
+package honoka
+
+// Migrate copies the index and every indexed bucket from src to dst, for
+// example from the directory layout into another Store. Buckets that no
+// index entry refers to are skipped. dst is locked during the copy; src is
+// only read, so writers to src should be stopped first.
+//
+// Example:
+//   db, err := boltstore.Open("~/.honoka/cache.db", 0644, time.Second)
+//   err = honoka.Migrate(db, honoka.NewFileStore(cli.Dir()))
+func Migrate(dst, src Store) error {
+    idx, err := src.LoadIndex()
+    if err == IndexFileNotFound {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+
+    unlock, err := dst.Lock(defaultLockTimeout)
+    if err != nil {
+        return err
+    }
+    defer unlock()
+
+    merged, err := dst.LoadIndex()
+    if err == IndexFileNotFound {
+        merged = IndexList{}
+    } else if err != nil {
+        return err
+    }
+    for key, entry := range idx {
+        data, err := src.ReadBucket(entry.Bucket)
+        if err == BucketFileNotFound {
+            continue
+        }
+        if err != nil {
+            return err
+        }
+        if err = dst.WriteBucket(entry.Bucket, data); err != nil {
+            return err
+        }
+        merged[key] = entry
+    }
+    return dst.SaveIndex(merged)
+}
@@ -0,0 +1,204 @@
+package honoka
+
+import (
+    "errors"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "regexp"
+    "sort"
+)
+
+var (
+    // ErrInvalidNamespace is returned by WithNamespace for names that are
+    // empty or contain characters other than letters, digits, '.', '_'
+    // and '-'.
+    ErrInvalidNamespace = errors.New("honoka: invalid namespace name")
+
+    // ErrNamespaceUnsupported is returned when a namespace is requested
+    // from a Store that does not implement Namespacer.
+    ErrNamespaceUnsupported = errors.New("honoka: store does not support namespaces")
+
+    namespacePattern = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*$`)
+)
+
+// Namespacer is implemented by stores that can hold several independent
+// caches. The Store itself holds the default namespace.
+type Namespacer interface {
+    // Namespace returns the Store of the named namespace, creating it if
+    // needed.
+    Namespace(name string) (Store, error)
+
+    // Namespaces returns the names of the existing namespaces, not
+    // including the default one.
+    Namespaces() ([]string, error)
+}
+
+// NamespaceInfo describes one namespace returned by Client.Namespaces.
+// The default namespace has an empty Name.
+type NamespaceInfo struct {
+    Name    string
+    Entries int
+    Bytes   int64
+}
+
+// WithNamespace gives the Client a cache of its own, with an index and
+// buckets separate from those of other namespaces under the same root.
+// The FileStore keeps it in <Dir>/namespaces/<name>.
+//
+// Example:
+//   cli, err := honoka.New(honoka.WithNamespace("github-api"))
+func WithNamespace(name string) Option {
+    return func(c *Client) error {
+        if !validNamespace(name) {
+            return ErrInvalidNamespace
+        }
+        c.namespace = name
+        return nil
+    }
+}
+
+// Namespace returns the name of the Client's namespace, or an empty
+// string for the default namespace.
+func (c *Client) Namespace() string {
+    return c.namespace
+}
+
+// Namespaces lists every namespace under the Client's root, including the
+// default one, with the number of entries and bytes of bucket data it
+// holds.
+//
+// Example:
+//   cli, err := honoka.New()
+//   list, err := cli.Namespaces()
+func (c *Client) Namespaces() ([]NamespaceInfo, error) {
+    list := []NamespaceInfo{}
+    info, err := namespaceInfo("", c.root)
+    if err != nil {
+        return nil, err
+    }
+    list = append(list, info)
+
+    ns, ok := c.root.(Namespacer)
+    if !ok {
+        return list, nil
+    }
+    names, err := ns.Namespaces()
+    if err != nil {
+        return nil, err
+    }
+    sort.Strings(names)
+    for _, name := range names {
+        store, err := ns.Namespace(name)
+        if err != nil {
+            return nil, err
+        }
+        info, err = namespaceInfo(name, store)
+        if err != nil {
+            return nil, err
+        }
+        list = append(list, info)
+    }
+    return list, nil
+}
+
+func namespaceInfo(name string, store Store) (NamespaceInfo, error) {
+    info := NamespaceInfo{Name: name}
+    idx, err := store.LoadIndex()
+    if err != nil {
+        if err == IndexFileNotFound {
+            return info, nil
+        }
+        return info, err
+    }
+    for _, i := range idx {
+        info.Entries++
+        info.Bytes += i.Size
+    }
+    return info, nil
+}
+
+func (c *Client) openNamespace() error {
+    c.root = c.store
+    if c.namespace == "" {
+        return nil
+    }
+    ns, ok := c.store.(Namespacer)
+    if !ok {
+        return ErrNamespaceUnsupported
+    }
+    store, err := ns.Namespace(c.namespace)
+    if err != nil {
+        return err
+    }
+    c.store = store
+    return nil
+}
+
+func validNamespace(name string) bool {
+    return namespacePattern.MatchString(name)
+}
+
+// Namespace returns a FileStore rooted at <Dir>/namespaces/<name> with the
+// same settings as s.
+func (s *FileStore) Namespace(name string) (Store, error) {
+    if !validNamespace(name) {
+        return nil, ErrInvalidNamespace
+    }
+    return &FileStore{
+        Dir:        s.getNamespacePath(name),
+        FileMode:   s.FileMode,
+        DirMode:    s.DirMode,
+        MaxJournal: s.MaxJournal,
+    }, nil
+}
+
+func (s *FileStore) Namespaces() ([]string, error) {
+    files, err := ioutil.ReadDir(s.getNamespacePath(""))
+    if err != nil {
+        if os.IsNotExist(err) {
+            return nil, nil
+        }
+        return nil, err
+    }
+    var list []string
+    for _, fi := range files {
+        if fi.IsDir() && validNamespace(fi.Name()) {
+            list = append(list, fi.Name())
+        }
+    }
+    return list, nil
+}
+
+func (s *FileStore) getNamespacePath(name string) string {
+    return filepath.Join(s.Dir, "namespaces", name)
+}
+
+// Namespace returns the MemoryStore of the named namespace.
+func (s *MemoryStore) Namespace(name string) (Store, error) {
+    if !validNamespace(name) {
+        return nil, ErrInvalidNamespace
+    }
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.namespaces == nil {
+        s.namespaces = make(map[string]*MemoryStore)
+    }
+    ns, exists := s.namespaces[name]
+    if !exists {
+        ns = NewMemoryStore()
+        s.namespaces[name] = ns
+    }
+    return ns, nil
+}
+
+func (s *MemoryStore) Namespaces() ([]string, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    var list []string
+    for name := range s.namespaces {
+        list = append(list, name)
+    }
+    sort.Strings(list)
+    return list, nil
+}
@@ -0,0 +1,59 @@
+package honoka
+
+import (
+    "path/filepath"
+    "testing"
+)
+
+func TestNamespaces(t *testing.T) {
+    dir := t.TempDir()
+    def := newTestClient(t, WithDir(dir))
+    github := newTestClient(t, WithDir(dir), WithNamespace("github-api"))
+
+    if err := def.Set("testNamespace", "default", 100); err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+    if err := github.Set("testNamespace", "github", 100); err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+    for cli, expected := range map[*Client]string{def: "default", github: "github"} {
+        actual, err := Get[string](cli, "testNamespace")
+        if err != nil || actual != expected {
+            t.Errorf("actual does not match expected. actual: %s (%v) , expected: %s", actual, err, expected)
+        }
+    }
+    if !fileExists(filepath.Join(dir, "namespaces", "github-api", "index")) {
+        t.Errorf("index of namespace is not in its own directory")
+    }
+
+    list, err := def.Namespaces()
+    if err != nil {
+        t.Fatalf("occurred error when list namespaces: %v", err)
+    }
+    if len(list) != 2 || list[0].Name != "" || list[1].Name != "github-api" {
+        t.Fatalf("actual does not match expected. actual: %+v , expected: %s", list, "default and github-api")
+    }
+    if list[1].Entries != 1 || list[1].Bytes == 0 {
+        t.Errorf("size of namespace is not reported: %+v", list[1])
+    }
+}
+
+func TestWithNamespaceInvalid(t *testing.T) {
+    for _, name := range []string{"", ".", "..", "../foo", "foo/bar"} {
+        if _, err := New(WithDir(t.TempDir()), WithNamespace(name)); err != ErrInvalidNamespace {
+            t.Errorf("actual does not match expected. actual: %v , expected: %v (%q)", err, ErrInvalidNamespace, name)
+        }
+    }
+}
+
+func TestMemoryStoreNamespaces(t *testing.T) {
+    store := NewMemoryStore()
+    def := newTestClient(t, WithStore(store))
+    ns := newTestClient(t, WithStore(store), WithNamespace("foo"))
+    if err := ns.Set("testNamespace", "foo", 100); err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+    if _, err := Get[string](def, "testNamespace"); err == nil {
+        t.Errorf("cache of namespace is visible from default namespace")
+    }
+}
@@ -0,0 +1,118 @@
+package honoka
+
+import (
+    "errors"
+    "os"
+    "path/filepath"
+    "time"
+
+    homedir "github.com/mitchellh/go-homedir"
+)
+
+// Option configures a Client created by New.
+type Option func(*Client) error
+
+const (
+    // EnvDir is the environment variable that overrides the default cache
+    // root directory (~/.honoka).
+    EnvDir = "HONOKA_DIR"
+
+    defaultFileMode os.FileMode = 0644
+    defaultDirMode  os.FileMode = 0700
+)
+
+// WithDir sets the root directory that holds the index file and buckets.
+//
+// Example:
+//   cli, err := honoka.New(honoka.WithDir("/tmp/myservice-cache"))
+func WithDir(dir string) Option {
+    return func(c *Client) error {
+        if dir == "" {
+            return errors.New("honoka: cache directory must not be empty")
+        }
+        path, err := homedir.Expand(dir)
+        if err != nil {
+            return err
+        }
+        c.dir = path
+        return nil
+    }
+}
+
+// WithFileMode sets the permission bits used for the index and bucket files.
+func WithFileMode(perm os.FileMode) Option {
+    return func(c *Client) error {
+        c.fileMode = perm
+        return nil
+    }
+}
+
+// WithDirMode sets the permission bits used when creating cache directories.
+func WithDirMode(perm os.FileMode) Option {
+    return func(c *Client) error {
+        c.dirMode = perm
+        return nil
+    }
+}
+
+// WithClock replaces time.Now, which is used to compute and check
+// expirations. It is mainly useful for tests.
+func WithClock(now func() time.Time) Option {
+    return func(c *Client) error {
+        if now == nil {
+            return errors.New("honoka: clock must not be nil")
+        }
+        c.now = now
+        return nil
+    }
+}
+
+// WithCorruptionAsMiss makes a bucket that fails its checksum behave like
+// a cache miss: its entry is dropped, Get reports CacheIsExpired and Update
+// refreshes it. Without it such reads fail with ErrCorrupted.
+func WithCorruptionAsMiss() Option {
+    return func(c *Client) error {
+        c.corruptionAsMiss = true
+        return nil
+    }
+}
+
+// defaultDir returns $HONOKA_DIR if it is set, or ~/.honoka otherwise.
+func defaultDir() (string, error) {
+    if dir := os.Getenv(EnvDir); dir != "" {
+        return homedir.Expand(dir)
+    }
+    home, err := homedir.Dir()
+    if err != nil {
+        return "", err
+    }
+    return filepath.Join(home, ".honoka"), nil
+}
+
+// CallOption configures a single call of a Client method such as Update.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+    forceRefresh bool
+    codec        Codec
+    version      *uint64
+}
+
+// ForceRefresh makes Update call its own UpdateFunc even if the cache is
+// still valid or a refresh of the same key is already in flight.
+//
+// Example:
+//   result, err := cli.UpdateJson("foobar", f, 100, honoka.ForceRefresh())
+func ForceRefresh() CallOption {
+    return func(o *callOptions) {
+        o.forceRefresh = true
+    }
+}
+
+func newCallOptions(opts []CallOption) callOptions {
+    var o callOptions
+    for _, opt := range opts {
+        opt(&o)
+    }
+    return o
+}
@@ -0,0 +1,113 @@
+package honoka
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "runtime/debug"
+    "sort"
+)
+
+// PanicError is the error of a background refresh whose UpdateFunc
+// panicked, see WithRefreshErrorHandler.
+type PanicError struct {
+    // The value passed to panic.
+    Value interface{}
+
+    // The stack of the goroutine that panicked.
+    Stack []byte
+}
+
+func (e *PanicError) Error() string {
+    return fmt.Sprintf("honoka: UpdateFunc panicked: %v", e.Value)
+}
+
+// WithStaleWhileRevalidate enables a grace window of the given seconds
+// after each entry's expiration. Within it, Update and UpdateJson return
+// the stale bucket right away and run the UpdateFunc in the background.
+// Failures of such refreshes go to WithRefreshErrorHandler.
+//
+// Example:
+//   cli, err := honoka.New(honoka.WithStaleWhileRevalidate(60))
+func WithStaleWhileRevalidate(grace int64) Option {
+    return func(c *Client) error {
+        if grace < 0 {
+            return errors.New("honoka: grace window must not be negative")
+        }
+        c.grace = grace
+        return nil
+    }
+}
+
+// WithRefreshErrorHandler sets a function that receives the key and the
+// error of every background refresh that fails. An UpdateFunc that panics
+// in the background is reported as a *PanicError instead of crashing the
+// process.
+//
+// Example:
+//   f := func(key string, err error) { log.Printf("refresh of %s failed: %v", key, err) }
+//   cli, err := honoka.New(honoka.WithStaleWhileRevalidate(60), honoka.WithRefreshErrorHandler(f))
+func WithRefreshErrorHandler(handler func(key string, err error)) Option {
+    return func(c *Client) error {
+        c.refreshError = handler
+        return nil
+    }
+}
+
+// Refreshing returns the keys that are being refreshed in the background.
+func (c *Client) Refreshing() []string {
+    c.bgMu.Lock()
+    defer c.bgMu.Unlock()
+    var keys []string
+    for key := range c.background {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+// Wait blocks until all background refreshes have finished.
+func (c *Client) Wait() {
+    c.bgWG.Wait()
+}
+
+// revalidate refreshes key in the background unless a background refresh
+// of key is already running. It joins any synchronous refresh in flight.
+// The refresh keeps the values of ctx but outlives its cancellation.
+// A panic of updater is recovered and discards the refresh, leaving the
+// stale entry in place; waiters on the refresh get it as a *PanicError,
+// and so does the handler of WithRefreshErrorHandler.
+func (c *Client) revalidate(ctx context.Context, key string, updater UpdateContextFunc, expire int64, o callOptions) {
+    c.bgMu.Lock()
+    if _, running := c.background[key]; running {
+        c.bgMu.Unlock()
+        return
+    }
+    if c.background == nil {
+        c.background = make(map[string]struct{})
+    }
+    c.background[key] = struct{}{}
+    c.bgWG.Add(1)
+    c.bgMu.Unlock()
+
+    ctx = context.WithoutCancel(ctx)
+    go func() {
+        defer func() {
+            c.bgMu.Lock()
+            delete(c.background, key)
+            c.bgMu.Unlock()
+            c.bgWG.Done()
+        }()
+        _, err := c.flights.do(ctx, key, func() (v cached, err error) {
+            defer func() {
+                if r := recover(); r != nil {
+                    err = &PanicError{Value: r, Stack: debug.Stack()}
+                }
+            }()
+            return c.refresh(ctx, key, updater, expire, o)
+        })
+        if err != nil && c.refreshError != nil {
+            c.refreshError(key, err)
+        }
+    }()
+}
@@ -0,0 +1,128 @@
+package honoka
+
+import (
+    "errors"
+    "testing"
+    "time"
+)
+
+func TestStaleWhileRevalidate(t *testing.T) {
+    now := time.Unix(1000, 0)
+    clock := func() time.Time { return now }
+    cli := newTestClient(t, WithClock(clock), WithStaleWhileRevalidate(60))
+
+    err := cli.Set("testStale", "old", 10)
+    if err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+
+    release := make(chan struct{})
+    updater := func() (interface{}, error) {
+        <-release
+        return "new", nil
+    }
+
+    now = now.Add(30 * time.Second)
+    b, err := cli.UpdateJson("testStale", updater, 10)
+    if err != nil {
+        t.Errorf("occurred error when update cache: %v", err)
+    }
+    if string(b) != "\"old\"" {
+        t.Errorf("actual does not match expected. actual: %s , expected: %s", b, "\"old\"")
+    }
+    if keys := cli.Refreshing(); len(keys) != 1 || keys[0] != "testStale" {
+        t.Errorf("background refresh is not running: %v", keys)
+    }
+
+    close(release)
+    cli.Wait()
+    if keys := cli.Refreshing(); len(keys) != 0 {
+        t.Errorf("background refresh is still running: %v", keys)
+    }
+    b, err = cli.GetJson("testStale")
+    if err != nil {
+        t.Errorf("occurred error when get cache: %v", err)
+    }
+    if string(b) != "\"new\"" {
+        t.Errorf("actual does not match expected. actual: %s , expected: %s", b, "\"new\"")
+    }
+    outdated, err := cli.Outdated()
+    if err != nil || len(outdated) != 0 {
+        t.Errorf("replaced buckets are left behind: %v (%v)", outdated, err)
+    }
+
+    // Past the grace window the caller waits for the updater again.
+    now = now.Add(100 * time.Second)
+    b, err = cli.UpdateJson("testStale", func() (interface{}, error) { return "newer", nil }, 10)
+    if err != nil {
+        t.Errorf("occurred error when update cache: %v", err)
+    }
+    if string(b) != "\"newer\"" {
+        t.Errorf("actual does not match expected. actual: %s , expected: %s", b, "\"newer\"")
+    }
+}
+
+func TestRefreshOfStaleEntryDeletesBucket(t *testing.T) {
+    now := time.Unix(1000, 0)
+    clock := func() time.Time { return now }
+    cli := newTestClient(t, WithClock(clock), WithStaleIfError(60))
+
+    err := cli.Set("testStaleRefresh", "old", 10)
+    if err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+
+    now = now.Add(30 * time.Second)
+    b, err := cli.UpdateJson("testStaleRefresh", func() (interface{}, error) { return "new", nil }, 10)
+    if err != nil || string(b) != "\"new\"" {
+        t.Errorf("actual does not match expected. actual: %s (%v) , expected: %s", b, err, "\"new\"")
+    }
+    outdated, err := cli.Outdated()
+    if err != nil || len(outdated) != 0 {
+        t.Errorf("replaced buckets are left behind: %v (%v)", outdated, err)
+    }
+}
+
+func TestRevalidatePanic(t *testing.T) {
+    now := time.Unix(1000, 0)
+    clock := func() time.Time { return now }
+    var reported []error
+    handler := func(key string, err error) {
+        if key == "testPanic" {
+            reported = append(reported, err)
+        }
+    }
+    cli := newTestClient(t, WithClock(clock), WithStaleWhileRevalidate(60), WithRefreshErrorHandler(handler))
+
+    if err := cli.Set("testPanic", "old", 10); err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+    updater := func() (interface{}, error) {
+        panic("updater failed")
+    }
+
+    now = now.Add(30 * time.Second)
+    b, err := cli.UpdateJson("testPanic", updater, 10)
+    if err != nil || string(b) != "\"old\"" {
+        t.Errorf("actual does not match expected. actual: %s (%v) , expected: %s", b, err, "\"old\"")
+    }
+    cli.Wait()
+    var perr *PanicError
+    if len(reported) != 1 || !errors.As(reported[0], &perr) || perr.Value != "updater failed" {
+        t.Errorf("actual does not match expected. actual: %v , expected: %s", reported, "the panic")
+    }
+
+    // The stale entry is still served and refreshed again.
+    b, err = cli.UpdateJson("testPanic", func() (interface{}, error) { return "new", nil }, 10)
+    if err != nil || string(b) != "\"old\"" {
+        t.Errorf("actual does not match expected. actual: %s (%v) , expected: %s", b, err, "\"old\"")
+    }
+    cli.Wait()
+    b, err = cli.GetJson("testPanic")
+    if err != nil || string(b) != "\"new\"" {
+        t.Errorf("actual does not match expected. actual: %s (%v) , expected: %s", b, err, "\"new\"")
+    }
+    if len(reported) != 1 {
+        t.Errorf("successful refresh is reported: %v", reported)
+    }
+}
@@ -0,0 +1,48 @@
+package honoka
+
+import (
+    "errors"
+)
+
+// StaleError is returned by Update and UpdateJson together with the last
+// good value when the refresh failed and stale-if-error is enabled.
+type StaleError struct {
+    // The error that made the refresh fail.
+    Err error
+}
+
+func (e *StaleError) Error() string {
+    return "honoka: serving stale cache: " + e.Err.Error()
+}
+
+func (e *StaleError) Unwrap() error {
+    return e.Err
+}
+
+// IsStale reports whether err marks a value as stale.
+//
+// Example:
+//   result, err := cli.UpdateJson("foobar", f, 100)
+//   if honoka.IsStale(err) {
+//       // result holds the last good value
+//   }
+func IsStale(err error) bool {
+    var se *StaleError
+    return errors.As(err, &se)
+}
+
+// WithStaleIfError keeps expired buckets for the given seconds after their
+// expiration. When a refresh fails within that window, Update and
+// UpdateJson return the last good value along with a StaleError.
+//
+// Example:
+//   cli, err := honoka.New(honoka.WithStaleIfError(24 * 60 * 60))
+func WithStaleIfError(window int64) Option {
+    return func(c *Client) error {
+        if window < 0 {
+            return errors.New("honoka: stale-if-error window must not be negative")
+        }
+        c.staleIfError = window
+        return nil
+    }
+}
@@ -0,0 +1,45 @@
+package honoka
+
+import (
+    "errors"
+    "testing"
+    "time"
+)
+
+func TestStaleIfError(t *testing.T) {
+    now := time.Unix(1000, 0)
+    clock := func() time.Time { return now }
+    cli := newTestClient(t, WithClock(clock), WithStaleIfError(60))
+
+    err := cli.Set("testFallback", "good", 10)
+    if err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+
+    offline := errors.New("upstream is offline")
+    failing := func() (interface{}, error) {
+        return nil, offline
+    }
+
+    now = now.Add(30 * time.Second)
+    if !cli.Expire("testFallback") {
+        t.Errorf("cache is not expired after its expiration")
+    }
+    b, err := cli.UpdateJson("testFallback", failing, 10)
+    if !IsStale(err) || !errors.Is(err, offline) {
+        t.Errorf("actual does not match expected. actual: %v , expected: stale %v", err, offline)
+    }
+    if string(b) != "\"good\"" {
+        t.Errorf("actual does not match expected. actual: %s , expected: %s", b, "\"good\"")
+    }
+
+    // Past the window the expired bucket is dropped.
+    now = now.Add(60 * time.Second)
+    b, err = cli.UpdateJson("testFallback", failing, 10)
+    if err != offline {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, offline)
+    }
+    if b != nil {
+        t.Errorf("stale value is returned after the window: %s", b)
+    }
+}
@@ -0,0 +1,84 @@
+package honoka
+
+import (
+    "context"
+    "errors"
+    "time"
+)
+
+// Store persists bucket payloads and the index for a Client.
+// FileStore, the default, keeps them in a directory; MemoryStore keeps them
+// in memory for tests.
+//
+// Client serializes index read-modify-write through Lock, so a Store only
+// needs to make each single call safe for concurrent use.
+type Store interface {
+    // ReadBucket returns the content of the named bucket, or
+    // BucketFileNotFound if it does not exist.
+    ReadBucket(name string) ([]byte, error)
+
+    // WriteBucket creates or replaces the named bucket. Readers must see
+    // either the old or the new content, never a partial write.
+    WriteBucket(name string, data []byte) error
+
+    // DeleteBucket removes the named bucket. Removing a missing bucket is
+    // not an error.
+    DeleteBucket(name string) error
+
+    // ListBuckets returns the names of all buckets.
+    ListBuckets() ([]string, error)
+
+    // LoadIndex returns the saved index, or IndexFileNotFound if no index
+    // was saved yet.
+    LoadIndex() (IndexList, error)
+
+    // SaveIndex replaces the saved index.
+    SaveIndex(idx IndexList) error
+
+    // Lock takes the exclusive lock that guards read-modify-write of the
+    // index, waiting up to timeout before failing with ErrLockTimeout.
+    // The returned function releases it.
+    Lock(timeout time.Duration) (func(), error)
+}
+
+// ContextLocker is implemented by stores whose Lock can be abandoned
+// early. LockContext is Lock that returns ctx.Err() once ctx is done.
+type ContextLocker interface {
+    LockContext(ctx context.Context, timeout time.Duration) (func(), error)
+}
+
+// EntryStore is implemented by stores that can read and write the index
+// entry of a single key without loading or saving the whole index. Client
+// uses it to delete keys, and to write a single key when it has no size
+// limit, and then only updates those keys in its in-memory index.
+type EntryStore interface {
+    // LoadEntry returns the saved index entry of key. exists is false if
+    // there is none.
+    LoadEntry(key string) (entry Index, exists bool, err error)
+
+    // PutEntry writes data as the bucket of entry and sets entry in the
+    // saved index, in a single transaction.
+    PutEntry(entry Index, data []byte) error
+
+    // DeleteEntries removes the index entries of keys, in a single
+    // transaction, and their buckets. Removing a missing key is not an
+    // error. A bucket that cannot be deleted once its entry is gone is
+    // left to Clean.
+    DeleteEntries(keys []string) error
+}
+
+// WithStore makes the Client persist its cache in store instead of the
+// default FileStore. WithDir, WithFileMode and WithDirMode only configure
+// the default store.
+//
+// Example:
+//   cli, err := honoka.New(honoka.WithStore(honoka.NewMemoryStore()))
+func WithStore(store Store) Option {
+    return func(c *Client) error {
+        if store == nil {
+            return errors.New("honoka: store must not be nil")
+        }
+        c.store = store
+        return nil
+    }
+}
@@ -0,0 +1,115 @@
+package honoka
+
+import (
+    "io/ioutil"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func testStore(t *testing.T, store Store) {
+    if _, err := store.LoadIndex(); err != IndexFileNotFound {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, IndexFileNotFound)
+    }
+    if _, err := store.ReadBucket("foobar"); err != BucketFileNotFound {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, BucketFileNotFound)
+    }
+
+    if err := store.WriteBucket("foobar", []byte("fizzbizz")); err != nil {
+        t.Fatalf("occurred error when write bucket: %v", err)
+    }
+    b, err := store.ReadBucket("foobar")
+    if err != nil || string(b) != "fizzbizz" {
+        t.Errorf("actual does not match expected. actual: %s (%v) , expected: %s", b, err, "fizzbizz")
+    }
+    list, err := store.ListBuckets()
+    if err != nil || len(list) != 1 || list[0] != "foobar" {
+        t.Errorf("actual does not match expected. actual: %v (%v) , expected: %v", list, err, []string{"foobar"})
+    }
+    if err = store.DeleteBucket("foobar"); err != nil {
+        t.Errorf("occurred error when delete bucket: %v", err)
+    }
+    if err = store.DeleteBucket("foobar"); err != nil {
+        t.Errorf("occurred error when delete missing bucket: %v", err)
+    }
+
+    idx := IndexList{"foo": {Key: "foo", Bucket: "bar", Expiration: 100}}
+    if err = store.SaveIndex(idx); err != nil {
+        t.Fatalf("occurred error when save index: %v", err)
+    }
+    loaded, err := store.LoadIndex()
+    if err != nil || loaded["foo"] != idx["foo"] {
+        t.Errorf("actual does not match expected. actual: %v (%v) , expected: %v", loaded, err, idx)
+    }
+
+    unlock, err := store.Lock(time.Second)
+    if err != nil {
+        t.Fatalf("occurred error when lock index: %v", err)
+    }
+    if _, err = store.Lock(20 * time.Millisecond); err != ErrLockTimeout {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, ErrLockTimeout)
+    }
+    unlock()
+    unlock, err = store.Lock(time.Second)
+    if err != nil {
+        t.Fatalf("occurred error when lock index again: %v", err)
+    }
+    unlock()
+}
+
+func TestFileStore(t *testing.T) {
+    testStore(t, NewFileStore(t.TempDir()))
+}
+
+func TestMemoryStore(t *testing.T) {
+    testStore(t, NewMemoryStore())
+}
+
+func TestClientWithMemoryStore(t *testing.T) {
+    cli, err := New(WithStore(NewMemoryStore()))
+    if err != nil {
+        t.Fatalf("occurred error when get cache client: %v", err)
+    }
+    if cli.Dir() != "" {
+        t.Errorf("directory is set for memory store: %s", cli.Dir())
+    }
+    if err = cli.Set("testMemoryStore", "foobar", 100); err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+    actual, err := Get[string](cli, "testMemoryStore")
+    if err != nil || actual != "foobar" {
+        t.Errorf("actual does not match expected. actual: %s (%v) , expected: %s", actual, err, "foobar")
+    }
+    if err = cli.Delete("testMemoryStore"); err != nil {
+        t.Errorf("occurred error when delete cache: %v", err)
+    }
+    outdated, err := cli.Outdated()
+    if err != nil || len(outdated) != 0 {
+        t.Errorf("bucket is left after delete: %v (%v)", outdated, err)
+    }
+}
+
+func TestFileStoreMigratesFlatLayout(t *testing.T) {
+    store := NewFileStore(t.TempDir())
+    dir, _ := store.getBucketsDirPath()
+    for _, name := range []string{"abcdef01", "abcdef02"} {
+        ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644)
+    }
+
+    b, err := store.ReadBucket("abcdef01")
+    if err != nil || string(b) != "abcdef01" {
+        t.Errorf("actual does not match expected. actual: %s (%v) , expected: %s", b, err, "abcdef01")
+    }
+    list, err := store.ListBuckets()
+    if err != nil || len(list) != 2 {
+        t.Errorf("actual does not match expected. actual: %v (%v) , expected: %d buckets", list, err, 2)
+    }
+    for _, name := range []string{"abcdef01", "abcdef02"} {
+        if fileExists(filepath.Join(dir, name)) {
+            t.Errorf("bucket is left in the flat layout: %s", name)
+        }
+        if !fileExists(filepath.Join(dir, "ab", "cd", name)) {
+            t.Errorf("bucket is not moved into its shard: %s", name)
+        }
+    }
+}
@@ -0,0 +1,134 @@
+package honoka
+
+import (
+    "context"
+    "fmt"
+    "reflect"
+)
+
+// DecodeError is returned by the typed functions when a cached value cannot
+// be decoded into the requested type.
+type DecodeError struct {
+    // The index key.
+    Key  string
+
+    // The requested type.
+    Type reflect.Type
+
+    // The error from the codec.
+    Err  error
+}
+
+func (e *DecodeError) Error() string {
+    return fmt.Sprintf("honoka: cannot decode cache %q into %v: %v", e.Key, e.Type, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+    return e.Err
+}
+
+// Get retrieves the cache of key and decodes it into a T with the codec
+// that wrote it, encoding/json by default, so struct tags, time.Time and
+// nested types round-trip as they were set.
+//
+// Example:
+//   cli, err := honoka.New()
+//   repo, err := honoka.Get[Repository](cli, "github:repo:honoka")
+func Get[T any](c *Client, key string) (T, error) {
+    return GetContext[T](context.Background(), c, key)
+}
+
+// GetContext is Get that gives up when ctx is done.
+func GetContext[T any](ctx context.Context, c *Client, key string) (T, error) {
+    v, _, err := fetchTyped[T](ctx, c, key)
+    return v, err
+}
+
+// fetchTyped is fetch followed by decodeCached, which also returns the
+// version.
+func fetchTyped[T any](ctx context.Context, c *Client, key string) (T, uint64, error) {
+    var v T
+    typ := reflect.TypeOf(&v).Elem()
+    d, version, err := c.fetchDecoded(ctx, key, typ, func(cache cached) (interface{}, error) {
+        var v T
+        err := decodeCached(key, cache, &v)
+        return v, err
+    })
+    v, _ = d.(T)
+    return v, version, err
+}
+
+// fetchDecoded is fetch followed by decode. With a memory tier the decoded
+// value is kept under typ, so that later hits skip decoding.
+func (c *Client) fetchDecoded(ctx context.Context, key string, typ reflect.Type, decode func(cached) (interface{}, error)) (interface{}, uint64, error) {
+    if c.memory != nil {
+        if idx, exists := c.lookup(key); exists && !c.expired(idx) {
+            if d, version, hit := c.memory.getDecoded(key, idx.Bucket, typ); hit {
+                c.touch(key)
+                return d, version, nil
+            }
+        }
+    }
+    cache, err := c.fetch(ctx, key)
+    if err != nil {
+        return nil, 0, err
+    }
+    v, err := decode(cache)
+    if err != nil {
+        return v, cache.version, err
+    }
+    c.memory.putDecoded(key, cache.version, typ, v)
+    return v, cache.version, nil
+}
+
+// Update is the typed form of Client.Update. It returns the cached value of
+// key, calling fn to refresh it when it is expired.
+//
+// Example:
+//   cli, err := honoka.New()
+//   f := func() (Repository, error) { return fetchRepository("honoka") }
+//   repo, err := honoka.Update(cli, "github:repo:honoka", f, 100)
+func Update[T any](c *Client, key string, fn func() (T, error), expire int64, opts ...CallOption) (T, error) {
+    f := func(context.Context) (T, error) {
+        return fn()
+    }
+    return UpdateContext(context.Background(), c, key, f, expire, opts...)
+}
+
+// UpdateContext is the typed form of Client.UpdateContext.
+//
+// Example:
+//   f := func(ctx context.Context) (Repository, error) { return fetchRepository(ctx, "honoka") }
+//   repo, err := honoka.UpdateContext(r.Context(), cli, "github:repo:honoka", f, 100)
+func UpdateContext[T any](ctx context.Context, c *Client, key string, fn func(context.Context) (T, error), expire int64, opts ...CallOption) (T, error) {
+    var v T
+    updater := func(ctx context.Context) (interface{}, error) {
+        val, err := fn(ctx)
+        return val, err
+    }
+    o := newCallOptions(opts)
+    cache, err := c.update(ctx, key, updater, expire, o)
+    if cache.data != nil {
+        o.reportVersion(cache.version)
+        if e := decodeCached(key, cache, &v); e != nil {
+            return v, e
+        }
+    }
+    return v, err
+}
+
+// decodeCached decodes a payload with the codec that wrote it.
+func decodeCached(key string, cache cached, v interface{}) error {
+    codec := cache.codec
+    if codec == nil {
+        codec = JSONCodec
+    }
+    if err := codec.Unmarshal(cache.data, v); err != nil {
+        return &DecodeError{
+            Key:  key,
+            Type: reflect.TypeOf(v).Elem(),
+            Err:  err,
+        }
+    }
+    return nil
+}
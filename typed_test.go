@@ -0,0 +1,56 @@
+package honoka
+
+import (
+    "errors"
+    "testing"
+    "time"
+)
+
+type typedRepository struct {
+    Name      string    `json:"name"`
+    Stars     int       `json:"stargazers_count"`
+    CreatedAt time.Time `json:"created_at"`
+    Topics    []string  `json:"topics"`
+}
+
+func TestTypedGet(t *testing.T) {
+    cli := newTestClient(t)
+    expected := typedRepository{
+        Name:      "honoka",
+        Stars:     42,
+        CreatedAt: time.Date(2015, 11, 5, 0, 0, 0, 0, time.UTC),
+        Topics:    []string{"cache", "golang"},
+    }
+    if err := cli.Set("testTyped", expected, 100); err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+
+    actual, err := Get[typedRepository](cli, "testTyped")
+    if err != nil {
+        t.Fatalf("occurred error when get cache: %v", err)
+    }
+    if actual.Name != expected.Name || actual.Stars != expected.Stars ||
+        !actual.CreatedAt.Equal(expected.CreatedAt) || len(actual.Topics) != 2 {
+        t.Errorf("actual does not match expected. actual: %+v , expected: %+v", actual, expected)
+    }
+
+    _, err = Get[int](cli, "testTyped")
+    var de *DecodeError
+    if !errors.As(err, &de) || de.Key != "testTyped" {
+        t.Errorf("type mismatch is not reported: %v", err)
+    }
+}
+
+func TestTypedUpdate(t *testing.T) {
+    cli := newTestClient(t)
+    f := func() ([]int, error) {
+        return []int{1, 2, 3}, nil
+    }
+    actual, err := Update(cli, "testTypedUpdate", f, 100)
+    if err != nil {
+        t.Fatalf("occurred error when update cache: %v", err)
+    }
+    if len(actual) != 3 || actual[2] != 3 {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", actual, []int{1, 2, 3})
+    }
+}
@@ -0,0 +1,150 @@
+package honoka
+
+import (
+    "encoding/json"
+    "errors"
+    "sort"
+)
+
+// VerifyReport is the result of Verify.
+type VerifyReport struct {
+    // Index entries whose bucket file is missing.
+    Missing   []Index
+
+    // Index entries whose bucket fails its checksum or cannot be decoded.
+    Corrupted []VerifyIssue
+
+    // Index entries that are already expired.
+    Expired   []Index
+
+    // Buckets that no index entry refers to. Clean deletes them.
+    Orphaned  []string
+
+    // Index entries and bucket files removed because fix was requested.
+    // Orphaned buckets appear with only Bucket set.
+    Removed   []Index
+}
+
+// VerifyIssue is an index entry whose bucket is unreadable.
+type VerifyIssue struct {
+    Index Index
+
+    // Why the bucket could not be read.
+    Error error
+}
+
+// OK reports whether no problem was found.
+func (r *VerifyReport) OK() bool {
+    return len(r.Missing) == 0 && len(r.Corrupted) == 0 &&
+        len(r.Expired) == 0 && len(r.Orphaned) == 0
+}
+
+var errInvalidJson = errors.New("honoka: bucket is not valid JSON")
+
+// Verify walks the index and the buckets directory and reports entries
+// whose bucket is missing or unreadable, expired entries and orphaned
+// buckets. With fix, the entries with a missing or unreadable bucket and
+// the expired entries that are not kept for stale serving are removed
+// from the index together with their bucket files, and orphaned buckets
+// are deleted as Clean does.
+//
+// Example:
+//   cli, err := honoka.New()
+//   report, err := cli.Verify(false)
+func (c *Client) Verify(fix bool) (*VerifyReport, error) {
+    if fix {
+        unlock, err := c.lockIndex()
+        if err != nil {
+            return nil, err
+        }
+        defer unlock()
+    }
+
+    idx, err := c.loadIndexer()
+    if err != nil {
+        return nil, err
+    }
+    buckets, err := c.store.ListBuckets()
+    if err != nil {
+        return nil, err
+    }
+
+    report := &VerifyReport{}
+    referenced := make(map[string]struct{})
+    keys := make([]string, 0, len(idx))
+    for key, entry := range idx {
+        referenced[entry.Bucket] = struct{}{}
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+
+    var bad []Index
+    for _, key := range keys {
+        entry := idx[key]
+        if c.expired(entry) {
+            report.Expired = append(report.Expired, entry)
+        }
+        err := c.checkBucket(entry)
+        if err == nil {
+            continue
+        }
+        if err == BucketFileNotFound {
+            report.Missing = append(report.Missing, entry)
+        } else {
+            report.Corrupted = append(report.Corrupted, VerifyIssue{Index: entry, Error: err})
+        }
+        bad = append(bad, entry)
+    }
+    for _, bucket := range buckets {
+        if _, exists := referenced[bucket]; !exists {
+            report.Orphaned = append(report.Orphaned, bucket)
+        }
+    }
+
+    if !fix {
+        return report, nil
+    }
+    conds := make(map[string]func(Index) bool)
+    removable := make(map[string]Index)
+    for _, entry := range report.Expired {
+        if c.removable(entry) {
+            conds[entry.Key] = nil
+            removable[entry.Key] = entry
+        }
+    }
+    for _, entry := range bad {
+        conds[entry.Key] = nil
+        removable[entry.Key] = entry
+    }
+    deleted, err := c.removeEntries(idx, conds)
+    for _, key := range deleted {
+        report.Removed = append(report.Removed, removable[key])
+    }
+    if err != nil {
+        return report, err
+    }
+    for _, r := range c.deleteBuckets(report.Orphaned) {
+        if r.Error != nil {
+            return report, r.Error
+        }
+        report.Removed = append(report.Removed, Index{Bucket: r.Bucket})
+    }
+    return report, nil
+}
+
+// checkBucket reads the bucket of idx and checks that it decodes.
+func (c *Client) checkBucket(idx Index) error {
+    codec, err := lookupCodec(idx.Codec)
+    if err != nil {
+        return err
+    }
+    data, err := c.getCacheFromBucket(idx)
+    if err != nil {
+        return err
+    }
+    // Other codecs need the concrete type to decode, so only JSON is checked.
+    if codec.Name() == JSONCodec.Name() && !json.Valid(data) {
+        return errInvalidJson
+    }
+    return nil
+}
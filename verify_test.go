@@ -0,0 +1,61 @@
+package honoka
+
+import (
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func TestVerify(t *testing.T) {
+    now := time.Unix(1000, 0)
+    cli := newTestClient(t, WithClock(func() time.Time { return now }))
+    for _, key := range []string{"testOK", "testMissing", "testCorrupted"} {
+        if err := cli.Set(key, key, 100); err != nil {
+            t.Fatalf("occurred error when set cache: %v", err)
+        }
+    }
+    if err := cli.Set("testExpired", "foobar", 10); err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+    missing, _ := cli.lookup("testMissing")
+    path, _ := fileStore(cli).getBucketPath(missing.Bucket)
+    os.Remove(path)
+    corruptBucket(t, cli, "testCorrupted")
+    dir, _ := fileStore(cli).getBucketsDirPath()
+    ioutil.WriteFile(filepath.Join(dir, "orphan"), []byte("{}"), 0644)
+    now = now.Add(50 * time.Second)
+
+    report, err := cli.Verify(false)
+    if err != nil {
+        t.Fatalf("occurred error when verify cache: %v", err)
+    }
+    if len(report.Missing) != 1 || report.Missing[0].Key != "testMissing" {
+        t.Errorf("missing bucket is not reported: %+v", report.Missing)
+    }
+    if len(report.Corrupted) != 1 || report.Corrupted[0].Index.Key != "testCorrupted" {
+        t.Errorf("corrupted bucket is not reported: %+v", report.Corrupted)
+    }
+    if len(report.Expired) != 1 || report.Expired[0].Key != "testExpired" {
+        t.Errorf("expired cache is not reported: %+v", report.Expired)
+    }
+    if len(report.Orphaned) != 1 || report.Orphaned[0] != "orphan" {
+        t.Errorf("orphaned bucket is not reported: %+v", report.Orphaned)
+    }
+
+    report, err = cli.Verify(true)
+    if err != nil {
+        t.Fatalf("occurred error when fix cache: %v", err)
+    }
+    if len(report.Removed) != 4 {
+        t.Errorf("actual does not match expected. actual: %d , expected: %d", len(report.Removed), 4)
+    }
+    report, _ = cli.Verify(false)
+    if !report.OK() {
+        t.Errorf("problems are left after fix: %+v", report)
+    }
+    if _, err = Get[string](cli, "testOK"); err != nil {
+        t.Errorf("valid cache is removed by fix: %v", err)
+    }
+}
@@ -0,0 +1,120 @@
+package honoka
+
+import (
+    "context"
+    "errors"
+)
+
+// ErrVersionMismatch is returned by CompareAndSwap when the key was
+// written since the expected version was read.
+var ErrVersionMismatch = errors.New("honoka: cache version does not match")
+
+// ReturnVersion stores the version of the cache that Set, SetNX, Put,
+// CompareAndSwap or Update wrote or found into v.
+//
+// Example:
+//   var version uint64
+//   err := cli.Set("foobar", "fizzbizz", 100, honoka.ReturnVersion(&version))
+func ReturnVersion(v *uint64) CallOption {
+    return func(o *callOptions) {
+        o.version = v
+    }
+}
+
+func (o callOptions) reportVersion(v uint64) {
+    if o.version != nil {
+        *o.version = v
+    }
+}
+
+// GetWithVersion is Get that also returns the version of the cache.
+//
+// Example:
+//   var output interface{}
+//   result, version, err := cli.GetWithVersion("foobar", &output)
+func (c *Client) GetWithVersion(key string, output interface{}) (interface{}, uint64, error) {
+    value, version, err := c.fetchValue(context.Background(), key)
+    if err != nil {
+        return nil, 0, err
+    }
+    result, err := weakDecodeValue(value, output)
+    return result, version, err
+}
+
+// GetWithVersion is the typed form of Client.GetWithVersion.
+func GetWithVersion[T any](c *Client, key string) (T, uint64, error) {
+    return fetchTyped[T](context.Background(), c, key)
+}
+
+// CompareAndSwap writes val as the cache of key only if the key still has
+// the expected version. An expected version of zero means the key must
+// not hold a valid cache. Otherwise it fails with ErrVersionMismatch.
+//
+// Example:
+//   repo, version, err := honoka.GetWithVersion[Repository](cli, "github:repo:honoka")
+//   repo.Stars++
+//   err = cli.CompareAndSwap("github:repo:honoka", version, repo, 100)
+func (c *Client) CompareAndSwap(key string, expected uint64, val interface{}, expire int64, opts ...CallOption) error {
+    return c.CompareAndSwapContext(context.Background(), key, expected, val, expire, opts...)
+}
+
+// CompareAndSwapContext is CompareAndSwap that gives up waiting for the
+// index lock when ctx is done.
+func (c *Client) CompareAndSwapContext(ctx context.Context, key string, expected uint64, val interface{}, expire int64, opts ...CallOption) error {
+    _, err := c.set(ctx, key, val, expire, ifVersion(expected), newCallOptions(opts))
+    return err
+}
+
+func ifVersion(expected uint64) setCond {
+    return func(current Index, valid bool) (bool, error) {
+        var version uint64
+        if valid {
+            version = current.Version
+        }
+        if version != expected {
+            return false, ErrVersionMismatch
+        }
+        return true, nil
+    }
+}
+
+// VersionStore is implemented by stores that remember the highest version
+// any index entry has had, including entries deleted since, so that a key
+// written again after a delete gets a higher version even if the clock
+// went back.
+type VersionStore interface {
+    // MaxVersion returns the highest version, or zero if there is none.
+    MaxVersion() (uint64, error)
+}
+
+// nextVersion returns the version for a new write over current. It is
+// taken from the clock, and kept above current's and above every version
+// the store has held, so that a key deleted and written again does not
+// repeat an old version. The caller must hold the index lock.
+func (c *Client) nextVersion(current Index) (uint64, error) {
+    floor := current.Version
+    if vs, ok := c.store.(VersionStore); ok {
+        max, err := vs.MaxVersion()
+        if err != nil {
+            return 0, err
+        }
+        if max > floor {
+            floor = max
+        }
+    }
+    v := uint64(c.now().UnixNano())
+    if v <= floor {
+        v = floor + 1
+    }
+    return v, nil
+}
+
+// highestVersion returns the highest of v and the versions in idx.
+func highestVersion(v uint64, idx IndexList) uint64 {
+    for _, entry := range idx {
+        if entry.Version > v {
+            v = entry.Version
+        }
+    }
+    return v
+}
@@ -0,0 +1,103 @@
+package honoka
+
+import (
+    "testing"
+    "time"
+)
+
+func TestVersion(t *testing.T) {
+    cli := newTestClient(t)
+    var set uint64
+    if err := cli.Set("testVersion", "foo", 100, ReturnVersion(&set)); err != nil {
+        t.Fatalf("occurred error when set cache: %v", err)
+    }
+    if set == 0 {
+        t.Errorf("version is not returned from set")
+    }
+    _, got, err := GetWithVersion[string](cli, "testVersion")
+    if err != nil || got != set {
+        t.Errorf("actual does not match expected. actual: %d (%v) , expected: %d", got, err, set)
+    }
+
+    var put uint64
+    if err = cli.Put("testVersion", "bar", 100, ReturnVersion(&put)); err != nil {
+        t.Fatalf("occurred error when put cache: %v", err)
+    }
+    if put <= set {
+        t.Errorf("version does not increase: %d -> %d", set, put)
+    }
+
+    // A key written again after delete does not reuse a version.
+    cli.Delete("testVersion")
+    var again uint64
+    cli.Set("testVersion", "fizz", 100, ReturnVersion(&again))
+    if again <= put {
+        t.Errorf("version does not increase across delete: %d -> %d", put, again)
+    }
+}
+
+func TestCompareAndSwap(t *testing.T) {
+    cli := newTestClient(t)
+    if err := cli.CompareAndSwap("testCAS", 0, "foo", 100); err != nil {
+        t.Fatalf("occurred error when create cache: %v", err)
+    }
+    var output interface{}
+    _, version, err := cli.GetWithVersion("testCAS", &output)
+    if err != nil {
+        t.Fatalf("occurred error when get cache: %v", err)
+    }
+
+    // Another writer wins in between.
+    other := newTestClient(t, WithDir(cli.Dir()))
+    if err = other.CompareAndSwap("testCAS", version, "bar", 100); err != nil {
+        t.Fatalf("occurred error when swap cache: %v", err)
+    }
+    if err = cli.CompareAndSwap("testCAS", version, "fizz", 100); err != ErrVersionMismatch {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, ErrVersionMismatch)
+    }
+    if err = cli.CompareAndSwap("testCAS", 0, "fizz", 100); err != ErrVersionMismatch {
+        t.Errorf("actual does not match expected. actual: %v , expected: %v", err, ErrVersionMismatch)
+    }
+    actual, _ := Get[string](cli, "testCAS")
+    if actual != "bar" {
+        t.Errorf("actual does not match expected. actual: %s , expected: %s", actual, "bar")
+    }
+}
+
+func TestVersionAcrossDeletes(t *testing.T) {
+    now := time.Unix(1000, 0)
+    clock := func() time.Time { return now }
+    dir := t.TempDir()
+    stores := map[string]func() Store{
+        "memory": func() Store { return NewMemoryStore() },
+        "file":   func() Store { return NewFileStore(dir) },
+    }
+    for name, open := range stores {
+        store := open()
+        cli := newTestClient(t, WithStore(store), WithClock(clock))
+        var first, second uint64
+        if err := cli.Set("testVersion", "foo", 100, ReturnVersion(&first)); err != nil {
+            t.Fatalf("occurred error when set cache: %v", err)
+        }
+        if err := cli.Delete("testVersion"); err != nil {
+            t.Fatalf("occurred error when delete cache: %v", err)
+        }
+        if fs, ok := store.(*FileStore); ok {
+            // The snapshot no longer holds the deleted entry, and a new
+            // Client has to read the version back.
+            if err := fs.Compact(); err != nil {
+                t.Fatalf("occurred error when compact index: %v", err)
+            }
+            cli = newTestClient(t, WithStore(open()), WithClock(clock))
+        }
+        if err := cli.Set("testVersion", "bar", 100, ReturnVersion(&second)); err != nil {
+            t.Fatalf("occurred error when set cache: %v", err)
+        }
+        if second <= first {
+            t.Errorf("%s: version does not increase across delete. actual: %d , expected: > %d", name, second, first)
+        }
+        if err := cli.CompareAndSwap("testVersion", first, "fizz", 100); err != ErrVersionMismatch {
+            t.Errorf("%s: actual does not match expected. actual: %v , expected: %v", name, err, ErrVersionMismatch)
+        }
+    }
+}